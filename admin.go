@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"reflect"
+
+	"github.com/gorilla/mux"
+	"purecloudwebservice/datadip"
+)
+
+// errConflict is returned when a record being created already exists
+var errConflict = errors.New("record already exists")
+
+// errNotJSON is returned for a request body that is not sent as JSON. Refusing other bodies keeps HTML forms on other
+// sites, which cannot send JSON, from changing records with the browser's saved admin credentials.
+var errNotJSON = errors.New("Content-Type must be application/json")
+
+// maxAdminBodySize is the largest record, in bytes, the admin API accepts
+const maxAdminBodySize = 1 << 20
+
+// errTooLarge is returned for a request body over maxAdminBodySize
+var errTooLarge = fmt.Errorf("record must be at most %d bytes", maxAdminBodySize)
+
+// invalidRecord is returned for a record that cannot be stored, saying why
+type invalidRecord string
+
+func (e invalidRecord) Error() string {
+	return string(e)
+}
+
+// adminCollection is a kind of record the admin API manages
+type adminCollection struct {
+	// Name is the path the records are served under, e.g. /admin/accounts
+	Name string
+	// Field is the storeFile field holding the records
+	Field string
+	// Key is the field of a record that identifies it, and KeyName its name in JSON
+	Key     string
+	KeyName string
+	// Validate returns what is wrong with record, about to be stored in data, other than its key
+	Validate func(data *storeFile, record interface{}) error
+}
+
+// adminCollections lists the records the admin API manages
+var adminCollections = []adminCollection{
+	{Name: "accounts", Field: "Accounts", Key: "Number", KeyName: "Number"},
+	{Name: "contacts", Field: "Contacts", Key: "ID", KeyName: "Id", Validate: validateContact},
+	{Name: "cases", Field: "Cases", Key: "ID", KeyName: "Id"},
+}
+
+// validateContact makes sure that no phone number of contact belongs to another contact, since contacts are looked up
+// by phone number.
+func validateContact(data *storeFile, record interface{}) error {
+	var contact = record.(*datadip.Contact)
+	if contact.PhoneNumbers == nil {
+		return nil
+	}
+	for _, other := range data.Contacts {
+		if other.ID == contact.ID || other.PhoneNumbers == nil {
+			continue
+		}
+		for _, p := range contact.PhoneNumbers.PhoneNumbers {
+			for _, q := range other.PhoneNumbers.PhoneNumbers {
+				if normalizePhoneNumber(p.Number) == normalizePhoneNumber(q.Number) {
+					return fmt.Errorf("phone number %s already belongs to contact %s", p.Number, other.ID)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// records returns the slice in data holding the collection's records.
+func (c adminCollection) records(data *storeFile) reflect.Value {
+	return reflect.ValueOf(data).Elem().FieldByName(c.Field)
+}
+
+// find returns the index of the record with key in data, or -1 if there is none.
+func (c adminCollection) find(data *storeFile, key string) int {
+	var records = c.records(data)
+	for i := 0; i < records.Len(); i++ {
+		if records.Index(i).FieldByName(c.Key).String() == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// decode reads a record from r, which must hold a single JSON object with only the fields of the record type, be sent
+// as application/json and be at most maxAdminBodySize bytes. It returns a pointer to the record.
+func (c adminCollection) decode(r *http.Request) (reflect.Value, error) {
+	var record = reflect.New(c.records(new(storeFile)).Type().Elem())
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		return record, errNotJSON
+	}
+	var body, err = ioutil.ReadAll(io.LimitReader(r.Body, maxAdminBodySize+1))
+	if err != nil {
+		return record, invalidRecord(fmt.Sprintf("invalid %s: %s", c.Name, err))
+	}
+	if len(body) > maxAdminBodySize {
+		return record, errTooLarge
+	}
+	var dec = json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(record.Interface()); err != nil {
+		return record, invalidRecord(fmt.Sprintf("invalid %s: %s", c.Name, err))
+	}
+	return record, nil
+}
+
+// adminAPI serves the admin API, which lists, creates, replaces and deletes the records of a file backend, and the
+// admin console. Changes are written to the backend's file straight away. Test lookups run in the console are
+// answered by actions.
+type adminAPI struct {
+	store   *fileStore
+	actions http.Handler
+}
+
+// newAdminRouter returns the HTTP router for the admin API configured in cfg, managing the records of its backend in
+// d. Every route requires the admin users. If the admin API is not configured, every request is not found.
+func newAdminRouter(cfg *config, d *dataDip) http.Handler {
+	if cfg.Admin == nil {
+		return http.NotFoundHandler()
+	}
+	var users = make(map[string]string)
+	for _, u := range cfg.Admin.Users {
+		users[u.Username] = u.Password
+	}
+
+	var a = &adminAPI{store: d.files[cfg.Admin.Backend], actions: d.handler(d.auditing()...)}
+	var r = mux.NewRouter()
+	r.HandleFunc("/admin/", a.console).Methods("GET")
+	r.HandleFunc("/admin/lookup", a.testLookup).Methods("POST")
+	r.HandleFunc("/admin/lookups", a.lookups).Methods("GET")
+	for _, c := range adminCollections {
+		r.HandleFunc("/admin/"+c.Name, a.list(c)).Methods("GET")
+		r.HandleFunc("/admin/"+c.Name, a.create(c)).Methods("POST")
+		r.HandleFunc("/admin/"+c.Name+"/{key}", a.get(c)).Methods("GET")
+		r.HandleFunc("/admin/"+c.Name+"/{key}", a.put(c)).Methods("PUT")
+		r.HandleFunc("/admin/"+c.Name+"/{key}", a.delete(c)).Methods("DELETE")
+	}
+	return requireBasicAuth(users, r)
+}
+
+// list handles HTTP GETs to /admin/{collection}, replying with every record.
+func (a *adminAPI) list(c adminCollection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var records = c.records(a.store.snapshot())
+		if records.Len() == 0 {
+			writeJSONStatus(w, http.StatusOK, []interface{}{})
+			return
+		}
+		writeJSONStatus(w, http.StatusOK, records.Interface())
+	}
+}
+
+// get handles HTTP GETs to /admin/{collection}/{key}, replying with the record with key.
+func (a *adminAPI) get(c adminCollection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var data = a.store.snapshot()
+		var i = c.find(data, mux.Vars(r)["key"])
+		if i < 0 {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintln(w, datadip.ErrNotFound)
+			return
+		}
+		writeJSONStatus(w, http.StatusOK, c.records(data).Index(i).Interface())
+	}
+}
+
+// create handles HTTP POSTs to /admin/{collection}, adding the record in the request body. It replies 409 Conflict
+// if a record with the same key exists.
+func (a *adminAPI) create(c adminCollection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var record, err = c.decode(r)
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		var key = record.Elem().FieldByName(c.Key).String()
+		err = a.store.update(func(data *storeFile) error {
+			if err := c.validate(data, record, key); err != nil {
+				return err
+			}
+			if c.find(data, key) >= 0 {
+				return errConflict
+			}
+			var records = c.records(data)
+			records.Set(reflect.Append(records, record.Elem()))
+			return nil
+		})
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		log.Printf("Admin created %s %s\n", c.Name, key)
+		writeJSONStatus(w, http.StatusCreated, record.Interface())
+	}
+}
+
+// put handles HTTP PUTs to /admin/{collection}/{key}, replacing the record with key by the one in the request body,
+// or adding it if there is none. The record's key is taken from the path if the body leaves it out.
+func (a *adminAPI) put(c adminCollection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var record, err = c.decode(r)
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		var key = mux.Vars(r)["key"]
+		var field = record.Elem().FieldByName(c.Key)
+		if field.String() == "" {
+			field.SetString(key)
+		}
+		err = a.store.update(func(data *storeFile) error {
+			if err := c.validate(data, record, key); err != nil {
+				return err
+			}
+			var records = c.records(data)
+			if i := c.find(data, key); i >= 0 {
+				records.Index(i).Set(record.Elem())
+			} else {
+				records.Set(reflect.Append(records, record.Elem()))
+			}
+			return nil
+		})
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		log.Printf("Admin replaced %s %s\n", c.Name, key)
+		writeJSONStatus(w, http.StatusOK, record.Interface())
+	}
+}
+
+// delete handles HTTP DELETEs to /admin/{collection}/{key}, removing the record with key.
+func (a *adminAPI) delete(c adminCollection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var key = mux.Vars(r)["key"]
+		var err = a.store.update(func(data *storeFile) error {
+			var i = c.find(data, key)
+			if i < 0 {
+				return datadip.ErrNotFound
+			}
+			var records = c.records(data)
+			records.Set(reflect.AppendSlice(records.Slice(0, i), records.Slice(i+1, records.Len())))
+			return nil
+		})
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		log.Printf("Admin deleted %s %s\n", c.Name, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// validate returns what is wrong with record, a pointer to a record about to be stored in data under key.
+func (c adminCollection) validate(data *storeFile, record reflect.Value, key string) error {
+	var k = record.Elem().FieldByName(c.Key).String()
+	if k == "" {
+		return invalidRecord(fmt.Sprintf("%s is required", c.KeyName))
+	}
+	if k != key {
+		return invalidRecord(fmt.Sprintf("%s %q does not match %q in the path", c.KeyName, k, key))
+	}
+	if c.Validate != nil {
+		if err := c.Validate(data, record.Interface()); err != nil {
+			return invalidRecord(err.Error())
+		}
+	}
+	return nil
+}
+
+// writeAdminError replies with the status that suits err: 400 Bad Request for an invalid record, 404 Not Found, 409
+// Conflict, 415 Unsupported Media Type for a body that is not JSON, or 500 Internal Server Error if the file could not
+// be written.
+func writeAdminError(w http.ResponseWriter, err error) {
+	var status int
+	switch err {
+	case datadip.ErrNotFound:
+		status = http.StatusNotFound
+	case errConflict:
+		status = http.StatusConflict
+	case errNotJSON:
+		status = http.StatusUnsupportedMediaType
+	case errTooLarge:
+		status = http.StatusRequestEntityTooLarge
+	default:
+		if _, ok := err.(invalidRecord); ok {
+			status = http.StatusBadRequest
+		} else {
+			log.Printf("Admin failed to update records: %s\n", err)
+			status = http.StatusInternalServerError
+		}
+	}
+	w.WriteHeader(status)
+	fmt.Fprintln(w, err)
+}
+
+// writeJSONStatus writes v as a JSON reply with status
+func writeJSONStatus(w http.ResponseWriter, status int, v interface{}) {
+	var b, err = json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err = w.Write(b); err != nil {
+		log.Printf("Failed to write: %s\n", err)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"purecloudwebservice/datadip/datadiptest"
+)
+
+// newTestAdmin returns the admin API router for a file backend holding one account and one contact, and the path
+// of the backend's file.
+func newTestAdmin(t *testing.T) (http.Handler, *dataDip, string) {
+	var dir, err = ioutil.TempDir("", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var path = filepath.Join(dir, "crm.json")
+	var data = `{"Accounts":[{"Id":"1","Number":"123","Name":"Ng Sze Min"}],` +
+		`"Contacts":[{"Id":"2","FullName":"Ng Sze Min","PhoneNumbers":{"PhoneNumber":[{"Number":"+60327763333"}]}}]}`
+	if err = ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg = &config{
+		Backends: []backendConfig{{Name: "crm", Type: backendFile, File: path}},
+		Admin:    &adminConfig{Users: []userConfig{{Username: "admin", Password: "secret"}}},
+	}
+	cfg.applyDefaults()
+	if problems := cfg.validate(); len(problems) > 0 {
+		t.Fatal(problems)
+	}
+	var d *dataDip
+	if d, err = newDataDip(cfg); err != nil {
+		t.Fatal(err)
+	}
+	return newRouter(cfg, d), d, path
+}
+
+// doAdmin sends a request to h as the admin user and returns the recorded response. A body is sent as JSON.
+func doAdmin(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	var req = httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.SetBasicAuth("admin", "secret")
+	var rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdmin(t *testing.T) {
+	var h, d, path = newTestAdmin(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	var tests = []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"list accounts", "GET", "/admin/accounts", "", http.StatusOK},
+		{"list cases when there are none", "GET", "/admin/cases", "", http.StatusOK},
+		{"get account", "GET", "/admin/accounts/123", "", http.StatusOK},
+		{"get missing account", "GET", "/admin/accounts/999", "", http.StatusNotFound},
+		{"create account", "POST", "/admin/accounts", `{"Number":"456","Name":"Someone"}`, http.StatusCreated},
+		{"create existing account", "POST", "/admin/accounts", `{"Number":"123"}`, http.StatusConflict},
+		{"create account without number", "POST", "/admin/accounts", `{"Name":"Nobody"}`, http.StatusBadRequest},
+		{"create account with unknown field", "POST", "/admin/accounts", `{"Number":"789","Nmae":"Typo"}`, http.StatusBadRequest},
+		{"create account with wrong type", "POST", "/admin/accounts", `{"Number":789}`, http.StatusBadRequest},
+		{"create account too large", "POST", "/admin/accounts", `{"Number":"789","Name":"` + strings.Repeat("x", maxAdminBodySize) + `"}`, http.StatusRequestEntityTooLarge},
+		{"replace account", "PUT", "/admin/accounts/123", `{"Name":"Renamed"}`, http.StatusOK},
+		{"replace account with other number", "PUT", "/admin/accounts/123", `{"Number":"456"}`, http.StatusBadRequest},
+		{"create contact with taken phone number", "POST", "/admin/contacts", `{"Id":"3","PhoneNumbers":{"PhoneNumber":[{"Number":"+60 3-2776 3333"}]}}`, http.StatusBadRequest},
+		{"create case", "PUT", "/admin/cases/c1", `{"ContactId":"2","Subject":"Billing","Status":"Open"}`, http.StatusOK},
+		{"delete contact", "DELETE", "/admin/contacts/2", "", http.StatusNoContent},
+		{"delete missing contact", "DELETE", "/admin/contacts/2", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		var rec = doAdmin(h, tt.method, tt.path, tt.body)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d; body %q", tt.name, rec.Code, tt.status, rec.Body.String())
+		}
+	}
+
+	// A record not sent as JSON, as an HTML form on another site would send it, is refused
+	for _, contentType := range []string{"", "text/plain", "application/x-www-form-urlencoded"} {
+		var req = httptest.NewRequest("POST", "/admin/accounts", strings.NewReader(`{"Number":"999"}`))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		req.SetBasicAuth("admin", "secret")
+		var rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("create account as %q: status = %d, want %d", contentType, rec.Code, http.StatusUnsupportedMediaType)
+		}
+	}
+
+	// Changes are answered by lookups and written to the file
+	var account, err = d.files["crm"].GetAccountByAccountNumber(context.Background(), "123")
+	if err != nil || account.Name != "Renamed" {
+		t.Errorf("account 123 = %+v, %v; want it renamed", account, err)
+	}
+	var data *storeFile
+	if data, err = readStoreFile(path, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Accounts) != 2 || len(data.Contacts) != 0 || len(data.Cases) != 1 || data.Cases[0].ID != "c1" {
+		t.Errorf("file holds %+v", data)
+	}
+}
+
+func TestAdminRequiresAdminUser(t *testing.T) {
+	var h, _, path = newTestAdmin(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	var req = httptest.NewRequest("GET", "/admin/accounts", nil)
+	req.SetBasicAuth("purecloud", "secret")
+	var rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestAdminConsole(t *testing.T) {
+	var h, _, path = newTestAdmin(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer recentLookups.setLimit(defaultRecentLookups)
+	// Start with an empty log that keeps two lookups
+	recentLookups.setLimit(0)
+	recentLookups.setLimit(2)
+
+	// Lookups made by the connector are kept, newest first, up to the limit
+	for _, number := range []string{"1", "2", "123"} {
+		datadiptest.Do(h, "POST", "/GetAccountByAccountNumber", `{"AccountNumber":"`+number+`"}`)
+	}
+	var lookups = recentLookups.recent()
+	if len(lookups) != 2 || lookups[0].Request != `{"AccountNumber":"123"}` || lookups[0].Status != http.StatusOK || lookups[1].Status != http.StatusNotFound {
+		t.Fatalf("recent lookups = %+v", lookups)
+	}
+
+	var rec = doAdmin(h, "GET", "/admin/", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Ng Sze Min") || !strings.Contains(rec.Body.String(), "60327763333") {
+		t.Errorf("console: status = %d, body %q", rec.Code, rec.Body.String())
+	}
+
+	// Test lookups show their reply but are not kept with the connector's
+	var req = httptest.NewRequest("POST", "/admin/lookup", strings.NewReader("action=GetContactByPhoneNumber&key=%2B60327763333"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("admin", "secret")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "&#34;FullName&#34;: &#34;Ng Sze Min&#34;") {
+		t.Errorf("test lookup: status = %d, body %q", rec.Code, rec.Body.String())
+	}
+	if n := len(recentLookups.recent()); n != 2 {
+		t.Errorf("%d lookups kept after a test lookup, want 2", n)
+	}
+
+	// Test lookups posted from a page on another site are refused
+	var tests = []struct {
+		name   string
+		header string
+		value  string
+		status int
+	}{
+		{"same origin", "Origin", "http://example.com", http.StatusOK},
+		{"other origin", "Origin", "https://evil.example", http.StatusForbidden},
+		{"same site fetch", "Sec-Fetch-Site", "same-origin", http.StatusOK},
+		{"cross site fetch", "Sec-Fetch-Site", "cross-site", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req = httptest.NewRequest("POST", "/admin/lookup", strings.NewReader("action=GetContactByPhoneNumber&key=%2B60327763333"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set(tt.header, tt.value)
+		req.SetBasicAuth("admin", "secret")
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.status)
+		}
+	}
+}
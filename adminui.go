@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"purecloudwebservice/datadip"
+)
+
+// adminPage is what the admin console shows
+type adminPage struct {
+	Accounts []datadip.Account
+	Contacts []datadip.Contact
+	Lookups  []lookupRecord
+	Actions  []datadip.Action
+	// Result is the test lookup just run, if any
+	Result *lookupRecord
+}
+
+// console handles HTTP GETs to /admin/, showing the admin console.
+func (a *adminAPI) console(w http.ResponseWriter, r *http.Request) {
+	a.render(w, nil)
+}
+
+// testLookup handles form POSTs to /admin/lookup. It sends a request built from the form's action, key and custom
+// attribute through the data dip handler, as the connector would, and shows the console with the reply. The lookup is
+// made as the admin user. Forms posted from other sites are refused with 403 Forbidden.
+func (a *adminAPI) testLookup(w http.ResponseWriter, r *http.Request) {
+	if !sameOrigin(r) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintln(w, "cross-site request")
+		return
+	}
+	var info, ok = datadip.FindAction(r.FormValue("action"))
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintln(w, "unknown action")
+		return
+	}
+	var body = map[string]string{info.KeyField: r.FormValue("key")}
+	if v := r.FormValue("custom"); v != "" {
+		body["CustomAttribute"] = v
+	}
+	var b, _ = json.Marshal(body)
+
+	log.Printf("Admin running test lookup %s %s\n", info.Name, b)
+	var req = actionRequest(r.Context(), info.Name, b)
+	var user, _, _ = r.BasicAuth()
+	req.SetBasicAuth(user, "")
+	var rec = datadip.NewRecorder()
+	var start = time.Now()
+	a.actions.ServeHTTP(rec, req)
+	a.render(w, &lookupRecord{
+		Time:     start,
+		Caller:   user,
+		Action:   info.Name,
+		Request:  string(b),
+		Status:   rec.Status,
+		Response: rec.Body.String(),
+		Latency:  duration(time.Since(start)),
+	})
+}
+
+// sameOrigin reports whether r, as far as the browser that sent it says, comes from a page served by this host.
+// Requests without Sec-Fetch-Site and Origin headers, e.g. from curl, are not made by a page on another site.
+func sameOrigin(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site == "same-origin" || site == "none"
+	}
+	var origin = r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	var u, err = url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+// lookups handles HTTP GETs to /admin/lookups, replying with the latest lookups, newest first.
+func (a *adminAPI) lookups(w http.ResponseWriter, r *http.Request) {
+	writeJSONStatus(w, http.StatusOK, recentLookups.recent())
+}
+
+// render writes the admin console, showing result if it is not nil.
+func (a *adminAPI) render(w http.ResponseWriter, result *lookupRecord) {
+	var data = a.store.snapshot()
+	var page = adminPage{Accounts: data.Accounts, Contacts: data.Contacts, Lookups: recentLookups.recent(), Actions: datadip.Actions, Result: result}
+	var buf bytes.Buffer
+	if err := adminTemplate.Execute(&buf, page); err != nil {
+		log.Printf("Failed to render admin console: %s\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintln(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+}
+
+// prettyJSON indents s if it is JSON, so that replies are readable in the console, or else returns it as it is.
+func prettyJSON(s string) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(s), "", "  "); err != nil {
+		return s
+	}
+	return buf.String()
+}
+
+// phoneNumbers lists the numbers in p, separated by commas.
+func phoneNumbers(p *datadip.PhoneNumbers) string {
+	if p == nil {
+		return ""
+	}
+	var numbers []string
+	for _, n := range p.PhoneNumbers {
+		numbers = append(numbers, n.Number)
+	}
+	return strings.Join(numbers, ", ")
+}
+
+// adminTemplate is the admin console page
+var adminTemplate = template.Must(template.New("admin").Funcs(template.FuncMap{
+	"pretty": prettyJSON,
+	"phones": phoneNumbers,
+	"time":   func(t time.Time) string { return t.Format("2006-01-02 15:04:05.000") },
+	"ok":     func(status int) bool { return status == http.StatusOK },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>purecloudwebservice admin</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+th { background: #eee; }
+pre { margin: 0; white-space: pre-wrap; max-width: 40em; }
+.failed { color: #b00; }
+</style>
+</head>
+<body>
+<h1>purecloudwebservice admin</h1>
+
+<h2>Test lookup</h2>
+<form method="post" action="/admin/lookup">
+<select name="action">{{range .Actions}}<option value="{{.Name}}">{{.Name}}{{if not .Implemented}} (not implemented){{end}}</option>{{end}}</select>
+<input name="key" placeholder="lookup key">
+<input name="custom" placeholder="CustomAttribute (optional)">
+<button type="submit">Look up</button>
+</form>
+{{with .Result}}
+<table>
+<tr><th>Action</th><td>{{.Action}}</td></tr>
+<tr><th>Request</th><td><pre>{{.Request}}</pre></td></tr>
+<tr><th>Status</th><td{{if not (ok .Status)}} class="failed"{{end}}>{{.Status}}</td></tr>
+<tr><th>Latency</th><td>{{.Latency}}</td></tr>
+<tr><th>Response</th><td><pre>{{pretty .Response}}</pre></td></tr>
+</table>
+{{end}}
+
+<h2>Recent lookups</h2>
+<p><a href="/admin/">Refresh</a></p>
+<table>
+<tr><th>Time</th><th>Action</th><th>Status</th><th>Latency</th><th>Request</th><th>Response</th></tr>
+{{range .Lookups}}<tr>
+<td>{{time .Time}}</td><td>{{.Action}}</td><td{{if not (ok .Status)}} class="failed"{{end}}>{{.Status}}</td><td>{{.Latency}}</td>
+<td><pre>{{pretty .Request}}</pre></td><td><pre>{{pretty .Response}}</pre></td>
+</tr>{{else}}<tr><td colspan="6">No lookups yet</td></tr>{{end}}
+</table>
+
+<h2>Accounts</h2>
+<table>
+<tr><th>Number</th><th>Id</th><th>Name</th><th>Phone numbers</th><th>CustomAttribute</th></tr>
+{{range .Accounts}}<tr><td>{{.Number}}</td><td>{{.ID}}</td><td>{{.Name}}</td><td>{{phones .PhoneNumbers}}</td><td>{{.CustomAttribute}}</td></tr>
+{{else}}<tr><td colspan="5">No accounts</td></tr>{{end}}
+</table>
+
+<h2>Contacts</h2>
+<table>
+<tr><th>Id</th><th>Full name</th><th>Phone numbers</th><th>CustomAttribute</th></tr>
+{{range .Contacts}}<tr><td>{{.ID}}</td><td>{{.FullName}}</td><td>{{phones .PhoneNumbers}}</td><td>{{.CustomAttribute}}</td></tr>
+{{else}}<tr><td colspan="4">No contacts</td></tr>{{end}}
+</table>
+</body>
+</html>
+`))
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// auditEntry is one lookup in the audit log. Hash is the SHA-256 of the entry, in hex, taken with Hash left empty.
+// Since that includes Prev, the Hash of the entry before, changing, removing or reordering entries breaks the chain
+// from there on.
+type auditEntry struct {
+	Seq      int64     `json:"seq"`
+	Time     time.Time `json:"time"`
+	Caller   string    `json:"caller"`
+	Action   string    `json:"action"`
+	Key      string    `json:"key"`
+	RecordID string    `json:"recordId"`
+	Outcome  string    `json:"outcome"`
+	Status   int       `json:"status"`
+	Prev     string    `json:"prev"`
+	Hash     string    `json:"hash"`
+}
+
+// hash returns the hash e should carry.
+func (e auditEntry) hash() string {
+	e.Hash = ""
+	var b, _ = json.Marshal(e)
+	var sum = sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// auditLog appends lookups to an audit file, chaining each entry to the one before
+type auditLog struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	seq  int64
+	last string
+}
+
+// auditLogs holds the audit logs opened, by absolute path, so that every configuration loaded in a process appends to
+// the same chain.
+var auditLogs = struct {
+	sync.Mutex
+	logs map[string]*auditLog
+}{logs: make(map[string]*auditLog)}
+
+// openAuditLog returns the audit log appending to the file at path, creating the file if needed. An existing file's
+// chain is carried on from its last entry.
+func openAuditLog(path string) (*auditLog, error) {
+	var err error
+	if path, err = filepath.Abs(path); err != nil {
+		return nil, err
+	}
+	auditLogs.Lock()
+	defer auditLogs.Unlock()
+	if l, ok := auditLogs.logs[path]; ok {
+		return l, nil
+	}
+
+	var f *os.File
+	if f, err = os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600); err != nil {
+		return nil, fmt.Errorf("audit log: %s", err)
+	}
+	var l = &auditLog{path: path, file: f}
+	var last *auditEntry
+	if last, err = lastAuditEntry(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("audit log %s: %s", path, err)
+	}
+	if last != nil {
+		l.seq, l.last = last.Seq, last.Hash
+	}
+	auditLogs.logs[path] = l
+	return l, nil
+}
+
+// lastAuditEntry returns the last entry in r, or nil if there is none.
+func lastAuditEntry(r io.Reader) (*auditEntry, error) {
+	var last *auditEntry
+	var scanner = newAuditScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		last = &e
+	}
+	return last, scanner.Err()
+}
+
+// newAuditScanner returns a scanner over the lines of an audit file
+func newAuditScanner(r io.Reader) *bufio.Scanner {
+	var scanner = bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return scanner
+}
+
+// add appends r, a lookup that has already been answered, to the log. The entry is written before add returns. A
+// failed write is logged, and leaves the lookup answered but not audited.
+func (l *auditLog) add(r lookupRecord) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var e = auditEntry{
+		Seq:      l.seq + 1,
+		Time:     r.Time.UTC(),
+		Caller:   r.Caller,
+		Action:   r.Action,
+		Key:      r.key(),
+		RecordID: r.recordID(),
+		Outcome:  r.result(),
+		Status:   r.Status,
+		Prev:     l.last,
+	}
+	e.Hash = e.hash()
+	var b, _ = json.Marshal(e)
+	if _, err := l.file.Write(append(b, '\n')); err != nil {
+		log.Printf("Failed to write audit log %s: %s\n", l.path, err)
+		return
+	}
+	l.seq, l.last = e.Seq, e.Hash
+}
+
+// verifyAudit checks the chain of entries in r, an audit file, returning how many entries there are and the hash of
+// the last. The error says at which line the chain is first broken.
+func verifyAudit(r io.Reader) (int, string, error) {
+	var count int
+	var last string
+	var scanner = newAuditScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return count, last, fmt.Errorf("line %d: %s", n, err)
+		}
+		switch {
+		case e.Seq != int64(count+1):
+			return count, last, fmt.Errorf("line %d: entry %d follows entry %d", n, e.Seq, count)
+		case e.Prev != last:
+			return count, last, fmt.Errorf("line %d: entry %d does not follow the entry before it", n, e.Seq)
+		case e.Hash != e.hash():
+			return count, last, fmt.Errorf("line %d: entry %d has been changed", n, e.Seq)
+		}
+		count++
+		last = e.Hash
+	}
+	return count, last, scanner.Err()
+}
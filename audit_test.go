@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"purecloudwebservice/datadip"
+	"purecloudwebservice/datadip/datadiptest"
+)
+
+func TestAuditLog(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var path = filepath.Join(dir, "audit.jsonl")
+
+	var d = newTestDataDip(datadiptest.NewStore(), time.Second)
+	if d.audit, err = openAuditLog(path); err != nil {
+		t.Fatal(err)
+	}
+	var cfg = &config{Auth: &authConfig{Users: []userConfig{{Username: "purecloud", Password: "secret"}}}}
+	var h = newRouter(cfg, d)
+	for _, body := range []string{`{"PhoneNumber":"+60327763333"}`, `{"PhoneNumber":"+1"}`} {
+		var req = httptest.NewRequest("POST", "/"+datadip.ActionGetContactByPhoneNumber, strings.NewReader(body))
+		req.SetBasicAuth("purecloud", "secret")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// A reloaded configuration carries on the same chain
+	var again *auditLog
+	if again, err = openAuditLog(path); err != nil || again != d.audit {
+		t.Fatalf("reopened audit log = %p, %v; want %p", again, err, d.audit)
+	}
+	again.add(lookupRecord{Time: time.Now(), Action: datadip.ActionGetAccountByAccountNumber, Request: `{"AccountNumber":"123"}`, Status: http.StatusOK, Response: `{"Account":{"Id":"1"}}`})
+
+	var data []byte
+	if data, err = ioutil.ReadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	var count, last, verr = verifyAudit(bytes.NewReader(data))
+	if verr != nil || count != 3 || last != d.audit.last {
+		t.Fatalf("verifyAudit = %d, %q, %v", count, last, verr)
+	}
+	var first auditEntry
+	if e, _ := lastAuditEntry(bytes.NewReader(data[:bytes.IndexByte(data, '\n')])); e != nil {
+		first = *e
+	}
+	if first.Seq != 1 || first.Caller != "purecloud" || first.Key != "+60327763333" || first.RecordID != "2" || first.Outcome != "found" || first.Prev != "" {
+		t.Errorf("first entry = %+v", first)
+	}
+
+	// Changing, removing or reordering entries is detected at the line it happens
+	var lines = strings.SplitAfter(strings.TrimSuffix(string(data), "\n"), "\n")
+	var tests = []struct {
+		name string
+		data string
+		want string
+	}{
+		{"changed key", lines[0] + strings.Replace(lines[1], `"+1"`, `"+2"`, 1) + lines[2], "line 2: entry 2 has been changed"},
+		{"removed entry", lines[0] + lines[2], "line 2: entry 3 follows entry 1"},
+		{"reordered entries", lines[1] + lines[0] + lines[2], "line 1: entry 2 follows entry 0"},
+		{"truncated entry", lines[0] + lines[1][:10], "line 2: unexpected end of JSON input"},
+	}
+	for _, tt := range tests {
+		if _, _, err := verifyAudit(strings.NewReader(tt.data)); err == nil || err.Error() != tt.want {
+			t.Errorf("%s: verifyAudit error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestAuditLogWithCommands(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var path = filepath.Join(dir, "audit.jsonl")
+	var configFile = filepath.Join(dir, "config.json")
+	var b, _ = json.Marshal(map[string]interface{}{
+		"audit": map[string]string{"file": path},
+		"rules": []ruleConfig{{Name: "all", Set: map[string]string{"tier": "gold"}}},
+	})
+	if err = ioutil.WriteFile(configFile, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Lookups from the command line between two of the server's leave its chain unbroken
+	var l *auditLog
+	if l, err = openAuditLog(path); err != nil {
+		t.Fatal(err)
+	}
+	var r = lookupRecord{Time: time.Now(), Action: datadip.ActionGetAccountByAccountNumber, Request: `{"AccountNumber":"123"}`, Status: http.StatusOK}
+	l.add(r)
+	lookup([]string{"-config", configFile, datadip.ActionGetAccountByAccountNumber, "123"})
+	rules([]string{"test", "-config", configFile, datadip.ActionGetAccountByAccountNumber, "123"})
+	l.add(r)
+
+	var f *os.File
+	if f, err = os.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if n, _, err := verifyAudit(f); n != 2 || err != nil {
+		t.Errorf("verified %d entries, %v; want the server's 2", n, err)
+	}
+}
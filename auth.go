@@ -0,0 +1,29 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// requireBasicAuth wraps next so that it only runs for requests carrying the HTTP Basic credentials of one of users,
+// which maps usernames to passwords. Other requests get 401 Unauthorized. If users is empty, every request is let
+// through.
+func requireBasicAuth(users map[string]string, next http.Handler) http.Handler {
+	if len(users) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var username, password, ok = r.BasicAuth()
+		var want, known = users[username]
+		if !ok || !known || subtle.ConstantTimeCompare([]byte(password), []byte(want)) != 1 {
+			log.Printf("Rejecting unauthorized request to %s\n", r.URL.Path)
+			w.Header().Set("WWW-Authenticate", `Basic realm="purecloudwebservice"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintln(w, http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"purecloudwebservice/datadip"
+)
+
+// Batch limits used unless the configuration sets its own
+const (
+	defaultBatchConcurrency = 8
+	defaultBatchMaxKeys     = 10000
+)
+
+// batchKeySize is how many bytes of the body a batch is allowed for each key it may hold, quotes and comma included.
+// It bounds the body read at maxKeys times this.
+const batchKeySize = 256
+
+// batchResult is one line of a batch reply: the lookup of the key at Index in the batch, and its reply. Response holds
+// the action's response when Status is 200 OK, and Error the reply body otherwise.
+type batchResult struct {
+	Index    int             `json:"index"`
+	Key      string          `json:"key"`
+	Status   int             `json:"status"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// batchHandler answers batch lookups, running each key through actions as if the connector had sent it
+type batchHandler struct {
+	actions     http.Handler
+	concurrency int
+	maxKeys     int
+}
+
+// newBatchHandler returns the batch handler configured in cfg, sending lookups to actions.
+func newBatchHandler(cfg *config, actions http.Handler) *batchHandler {
+	var b = &batchHandler{actions: actions, concurrency: defaultBatchConcurrency, maxKeys: defaultBatchMaxKeys}
+	if cfg.Batch != nil && cfg.Batch.Concurrency > 0 {
+		b.concurrency = cfg.Batch.Concurrency
+	}
+	if cfg.Batch != nil && cfg.Batch.MaxKeys > 0 {
+		b.maxKeys = cfg.Batch.MaxKeys
+	}
+	return b
+}
+
+// ServeHTTP handles HTTP POSTs to /batch/{action}. The request body is a JSON array of lookup keys, e.g. account
+// numbers or phone numbers. Each key is looked up like a request from the connector, with up to concurrency lookups
+// running at once, and the reply streams a batchResult per key as JSON Lines in the order the lookups finish. The body
+// may be at most batchKeySize bytes for each key a batch may hold.
+func (b *batchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var info, ok = datadip.FindAction(mux.Vars(r)["action"])
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintln(w, "unknown action")
+		return
+	}
+	if !info.Implemented {
+		w.WriteHeader(http.StatusNotImplemented)
+		fmt.Fprintf(w, "%s is not implemented\n", info.Name)
+		return
+	}
+	var maxBody = int64(b.maxKeys) * batchKeySize
+	var body, err = ioutil.ReadAll(io.LimitReader(r.Body, maxBody+1))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "failed to read request body: %s\n", err)
+		return
+	}
+	if int64(len(body)) > maxBody {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		fmt.Fprintf(w, "a batch body may be at most %d bytes\n", maxBody)
+		return
+	}
+	var keys []string
+	if err = json.Unmarshal(body, &keys); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "request body must be a JSON array of %s values: %s\n", info.KeyField, err)
+		return
+	}
+	if len(keys) > b.maxKeys {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "a batch holds at most %d keys, got %d\n", b.maxKeys, len(keys))
+		return
+	}
+	log.Printf("Processing batch of %d %s lookups...\n", len(keys), info.Name)
+
+	// Workers look up keys by index and pass their results on to be written
+	var indexes = make(chan int)
+	var results = make(chan batchResult)
+	var wg sync.WaitGroup
+	for i := 0; i < b.concurrency && i < len(keys); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results <- b.lookup(r, info, i, keys[i])
+			}
+		}()
+	}
+	go func() {
+		defer close(indexes)
+		for i := range keys {
+			select {
+			case indexes <- i:
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var flusher, _ = w.(http.Flusher)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	var enc = json.NewEncoder(w)
+	var written int
+	for res := range results {
+		enc.Encode(res)
+		if flusher != nil {
+			flusher.Flush()
+		}
+		written++
+	}
+	log.Printf("Sent %d of %d %s batch results\n", written, len(keys), info.Name)
+}
+
+// lookup sends the lookup of key to the actions as the connector would, as the caller of r, and returns its result.
+func (b *batchHandler) lookup(r *http.Request, info datadip.Action, index int, key string) batchResult {
+	var body, _ = json.Marshal(map[string]string{info.KeyField: key})
+	var req = actionRequest(r.Context(), info.Name, body)
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	var rec = datadip.NewRecorder()
+	b.actions.ServeHTTP(rec, req)
+
+	var res = batchResult{Index: index, Key: key, Status: rec.Status}
+	if rec.Status == http.StatusOK && json.Valid(rec.Body.Bytes()) {
+		res.Response = json.RawMessage(bytes.TrimSpace(rec.Body.Bytes()))
+	} else {
+		res.Error = strings.TrimSpace(rec.Body.String())
+	}
+	return res
+}
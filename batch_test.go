@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"purecloudwebservice/datadip"
+	"purecloudwebservice/datadip/datadiptest"
+)
+
+func TestBatch(t *testing.T) {
+	var cfg = &config{Batch: &batchConfig{Concurrency: 2, MaxKeys: 3}}
+	var h = newTestRouter(cfg, datadiptest.NewStore(), time.Second)
+
+	var rec = datadiptest.Do(h, "POST", "/batch/"+datadip.ActionGetAccountByAccountNumber, `["123","999","123"]`)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("status = %d, Content-Type = %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var results = make(map[int]batchResult)
+	var scanner = bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		var res batchResult
+		if err := json.Unmarshal(scanner.Bytes(), &res); err != nil {
+			t.Fatalf("%s: %s", scanner.Text(), err)
+		}
+		results[res.Index] = res
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3: %+v", len(results), results)
+	}
+	for _, i := range []int{0, 2} {
+		var resp datadip.AccountResponse
+		if res := results[i]; res.Key != "123" || res.Status != http.StatusOK || json.Unmarshal(res.Response, &resp) != nil || resp.Account.Name != "Ng Sze Min" {
+			t.Errorf("result %d = %+v", i, res)
+		}
+	}
+	if res := results[1]; res.Key != "999" || res.Status != http.StatusNotFound || res.Response != nil || res.Error == "" {
+		t.Errorf("result 1 = %+v", res)
+	}
+
+	var tests = []struct {
+		name   string
+		path   string
+		body   string
+		status int
+	}{
+		{"unknown action", "/batch/GetNothing", `["1"]`, http.StatusNotFound},
+		{"action not implemented", "/batch/" + datadip.ActionGetAccountByContactID, `["1"]`, http.StatusNotImplemented},
+		{"not a list of keys", "/batch/" + datadip.ActionGetAccountByAccountNumber, `{"AccountNumber":"123"}`, http.StatusBadRequest},
+		{"too many keys", "/batch/" + datadip.ActionGetAccountByAccountNumber, `["1","2","3","4"]`, http.StatusBadRequest},
+		{"body too large", "/batch/" + datadip.ActionGetAccountByAccountNumber, `["` + strings.Repeat("1", 3*batchKeySize) + `"]`, http.StatusRequestEntityTooLarge},
+		{"no keys", "/batch/" + datadip.ActionGetAccountByAccountNumber, `[]`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if rec := datadiptest.Do(h, "POST", tt.path, tt.body); rec.Code != tt.status || (tt.status == http.StatusOK && strings.TrimSpace(rec.Body.String()) != "") {
+			t.Errorf("%s: status = %d, want %d; body %q", tt.name, rec.Code, tt.status, rec.Body.String())
+		}
+	}
+}
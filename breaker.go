@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"sort"
+	"sync"
+	"time"
+
+	"purecloudwebservice/datadip"
+)
+
+// breakerSettings says how many consecutive failures open a circuit breaker and how long it stays open before a
+// probe lookup is let through.
+type breakerSettings struct {
+	FailureThreshold int
+	OpenTimeout      time.Duration
+}
+
+// defaultBreakerSettings is used for backends that do not set their own circuit breaker settings
+var defaultBreakerSettings = breakerSettings{FailureThreshold: 5, OpenTimeout: 30 * time.Second}
+
+// Circuit breaker states
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+// breakers holds the circuit breaker of every backend in use by backend name, so that readiness checks and metrics
+// can find them. Backends in shadowOnly only take shadow lookups, so readiness checks leave them out.
+var breakers = struct {
+	sync.Mutex
+	m          map[string]*circuitBreaker
+	shadowOnly map[string]bool
+}{m: make(map[string]*circuitBreaker)}
+
+func init() {
+	// Expose the state of every circuit breaker in use by backend name
+	expvar.Publish("breakers", expvar.Func(func() interface{} {
+		breakers.Lock()
+		defer breakers.Unlock()
+		var states = make(map[string]string, len(breakers.m))
+		for name, b := range breakers.m {
+			states[name] = b.currentState()
+		}
+		return states
+	}))
+}
+
+// setBreakers replaces the circuit breakers in use with m, which holds them by backend name, and the backends that
+// only take shadow lookups with shadowOnly.
+func setBreakers(m map[string]*circuitBreaker, shadowOnly map[string]bool) {
+	breakers.Lock()
+	breakers.m = m
+	breakers.shadowOnly = shadowOnly
+	breakers.Unlock()
+}
+
+// circuitBreaker tracks the health of one backend. It opens after FailureThreshold consecutive failures, failing
+// lookups fast while open. Once OpenTimeout has passed it half-opens and lets a single probe lookup through: success
+// closes it again and failure re-opens it. Each time it opens a new period starts, and the outcomes of lookups let
+// through before it are ignored, so a slow lookup from before the breaker opened can neither close it nor count
+// against the probe.
+type circuitBreaker struct {
+	settings breakerSettings
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	period   int
+	probing  bool
+}
+
+// breakerTicket is handed out by allow to a lookup it lets through, to be passed back with its outcome. It holds the
+// period the lookup was let through in and whether the lookup is the probe.
+type breakerTicket struct {
+	period int
+	probe  bool
+}
+
+// newCircuitBreaker returns a closed circuit breaker.
+func newCircuitBreaker(settings breakerSettings) *circuitBreaker {
+	return &circuitBreaker{settings: settings, state: breakerClosed}
+}
+
+// allow reports whether a lookup may go to the backend now, and if so returns its ticket.
+func (b *circuitBreaker) allow() (breakerTicket, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.settings.OpenTimeout {
+			return breakerTicket{}, false
+		}
+		b.setState(breakerHalfOpen)
+		b.probing = true
+		return breakerTicket{period: b.period, probe: true}, true
+	case breakerHalfOpen:
+		// Only one probe at a time
+		if b.probing {
+			return breakerTicket{}, false
+		}
+		b.probing = true
+		return breakerTicket{period: b.period, probe: true}, true
+	}
+	return breakerTicket{period: b.period}, true
+}
+
+// record updates the breaker with the outcome of the lookup allow gave t to. Outcomes of lookups let through before
+// the breaker last opened are ignored.
+func (b *circuitBreaker) record(t breakerTicket, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if t.period != b.period {
+		return
+	}
+	if t.probe {
+		b.probing = false
+	}
+	if !failed {
+		b.failures = 0
+		b.setState(breakerClosed)
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.settings.FailureThreshold {
+		b.openedAt = time.Now()
+		b.period++
+		b.setState(breakerOpen)
+	}
+}
+
+// release lets another probe through after the lookup allow gave t to ended without saying anything about the
+// backend, if it was the probe.
+func (b *circuitBreaker) release(t breakerTicket) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if t.probe && t.period == b.period {
+		b.probing = false
+	}
+}
+
+// currentState returns the breaker state, one of breakerClosed, breakerOpen or breakerHalfOpen. An open breaker whose
+// OpenTimeout has passed is reported as half-open, since the next lookup will probe the backend.
+func (b *circuitBreaker) currentState() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerOpen && time.Since(b.openedAt) >= b.settings.OpenTimeout {
+		return breakerHalfOpen
+	}
+	return b.state
+}
+
+// setState changes the breaker state. b.mu must be held.
+func (b *circuitBreaker) setState(state string) {
+	b.state = state
+}
+
+// openBreakers returns the sorted names of backends whose circuit breaker is open, leaving out those that only take
+// shadow lookups.
+func openBreakers() []string {
+	breakers.Lock()
+	defer breakers.Unlock()
+
+	var names []string
+	for name, b := range breakers.m {
+		if b.currentState() == breakerOpen && !breakers.shadowOnly[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// breakerStore wraps a Store with a circuit breaker, returning ErrUnavailable without calling the backend while the
+// breaker is open.
+type breakerStore struct {
+	backend datadip.CaseStore
+	breaker *circuitBreaker
+}
+
+// newBreakerStore returns a Store that guards backend with a circuit breaker.
+func newBreakerStore(backend datadip.CaseStore, settings breakerSettings) *breakerStore {
+	return &breakerStore{backend: backend, breaker: newCircuitBreaker(settings)}
+}
+
+// GetAccountByAccountNumber looks up an account unless the backend's circuit breaker is open.
+func (s *breakerStore) GetAccountByAccountNumber(ctx context.Context, accountNumber string) (*datadip.Account, error) {
+	var account *datadip.Account
+	var err = s.do(ctx, func() error {
+		var err error
+		account, err = s.backend.GetAccountByAccountNumber(ctx, accountNumber)
+		return err
+	})
+	return account, err
+}
+
+// GetContactByPhoneNumber looks up a contact unless the backend's circuit breaker is open.
+func (s *breakerStore) GetContactByPhoneNumber(ctx context.Context, phoneNumber string) (*datadip.Contact, error) {
+	var contact *datadip.Contact
+	var err = s.do(ctx, func() error {
+		var err error
+		contact, err = s.backend.GetContactByPhoneNumber(ctx, phoneNumber)
+		return err
+	})
+	return contact, err
+}
+
+// GetMostRecentOpenCaseByContactID looks up a case unless the backend's circuit breaker is open.
+func (s *breakerStore) GetMostRecentOpenCaseByContactID(ctx context.Context, contactID string) (*datadip.Case, error) {
+	var c *datadip.Case
+	var err = s.do(ctx, func() error {
+		var err error
+		c, err = s.backend.GetMostRecentOpenCaseByContactID(ctx, contactID)
+		return err
+	})
+	return c, err
+}
+
+// do calls fn if the breaker allows it and records the outcome. ErrNotFound is a healthy answer, and a lookup
+// cancelled by its caller says nothing about the backend.
+func (s *breakerStore) do(ctx context.Context, fn func() error) error {
+	var ticket, ok = s.breaker.allow()
+	if !ok {
+		return datadip.ErrUnavailable
+	}
+	var err = fn()
+	if err == context.Canceled && ctx.Err() == context.Canceled {
+		s.breaker.release(ticket)
+		return err
+	}
+	s.breaker.record(ticket, err != nil && err != datadip.ErrNotFound)
+	return err
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"purecloudwebservice/datadip"
+	"purecloudwebservice/datadip/datadiptest"
+)
+
+func TestBreakerStore(t *testing.T) {
+	var crmDown = errors.New("crm down")
+	var backend = datadiptest.NewStore()
+	var s = newBreakerStore(backend, breakerSettings{FailureThreshold: 2, OpenTimeout: 30 * time.Millisecond})
+	var lookup = func(key string) error {
+		var _, err = s.GetAccountByAccountNumber(context.Background(), key)
+		return err
+	}
+
+	var steps = []struct {
+		name  string
+		fail  error
+		key   string
+		wait  time.Duration
+		want  error
+		state string
+		calls int
+	}{
+		{"healthy", nil, "123", 0, nil, breakerClosed, 1},
+		{"not found is healthy", nil, "999", 0, datadip.ErrNotFound, breakerClosed, 2},
+		{"first failure", crmDown, "123", 0, crmDown, breakerClosed, 3},
+		{"threshold reached", crmDown, "123", 0, crmDown, breakerOpen, 4},
+		{"open fails fast", nil, "123", 0, datadip.ErrUnavailable, breakerOpen, 4},
+		{"failed probe re-opens", crmDown, "123", 40 * time.Millisecond, crmDown, breakerOpen, 5},
+		{"still open", nil, "123", 0, datadip.ErrUnavailable, breakerOpen, 5},
+		{"probe closes", nil, "123", 40 * time.Millisecond, nil, breakerClosed, 6},
+		{"closed again", crmDown, "123", 0, crmDown, breakerClosed, 7},
+	}
+	for _, st := range steps {
+		time.Sleep(st.wait)
+		backend.Err = st.fail
+		if err := lookup(st.key); err != st.want {
+			t.Fatalf("%s: err = %v, want %v", st.name, err, st.want)
+		}
+		if got := s.breaker.currentState(); got != st.state {
+			t.Fatalf("%s: state = %s, want %s", st.name, got, st.state)
+		}
+		if n := backend.Calls(); n != st.calls {
+			t.Fatalf("%s: backend calls = %d, want %d", st.name, n, st.calls)
+		}
+	}
+}
+
+func TestBreakerProbe(t *testing.T) {
+	var b = newCircuitBreaker(breakerSettings{FailureThreshold: 1, OpenTimeout: 0})
+	var ticket, _ = b.allow()
+	b.record(ticket, true)
+	var probe, ok = b.allow()
+	if !ok || !probe.probe {
+		t.Fatal("probe not allowed once the open timeout has passed")
+	}
+	if _, ok = b.allow(); ok {
+		t.Error("second probe allowed while the first is in flight")
+	}
+
+	b.release(probe)
+
+	// A probe cancelled by its caller lets another through without closing or re-opening the breaker
+	var backend = datadiptest.NewStore()
+	backend.Delay = time.Second
+	var s = &breakerStore{backend: backend, breaker: b}
+	var ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.GetContactByPhoneNumber(ctx, "+60327763333"); err != context.Canceled {
+		t.Errorf("cancelled probe: err = %v", err)
+	}
+	if _, ok = b.allow(); !ok || b.currentState() != breakerHalfOpen {
+		t.Errorf("after a cancelled probe: state = %s", b.currentState())
+	}
+}
+
+func TestBreakerLateOutcomes(t *testing.T) {
+	var crmDown = errors.New("crm down")
+	var slow = make(chan struct{})
+	var backend = datadiptest.NewStore()
+	backend.Hook = func(ctx context.Context, key string) error {
+		switch key {
+		case "slow":
+			<-slow
+			return datadip.ErrNotFound
+		case "down":
+			return crmDown
+		}
+		return nil
+	}
+	var s = newBreakerStore(backend, breakerSettings{FailureThreshold: 1, OpenTimeout: time.Hour})
+
+	// A slow lookup let through before the breaker trips does not close it when it finally succeeds
+	var done = make(chan error)
+	go func() {
+		var _, err = s.GetAccountByAccountNumber(context.Background(), "slow")
+		done <- err
+	}()
+	for backend.Calls() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	s.GetAccountByAccountNumber(context.Background(), "down")
+	if got := s.breaker.currentState(); got != breakerOpen {
+		t.Fatalf("after a failure: state = %s, want %s", got, breakerOpen)
+	}
+	close(slow)
+	if err := <-done; err != datadip.ErrNotFound {
+		t.Fatalf("slow lookup: err = %v", err)
+	}
+	if got := s.breaker.currentState(); got != breakerOpen {
+		t.Errorf("after the slow lookup succeeded: state = %s, want %s", got, breakerOpen)
+	}
+
+	// Nor does a late failure from before the breaker opened free the probe slot for a second probe
+	var b = newCircuitBreaker(breakerSettings{FailureThreshold: 1, OpenTimeout: 0})
+	var early, _ = b.allow()
+	var ticket, _ = b.allow()
+	b.record(ticket, true)
+	if _, ok := b.allow(); !ok {
+		t.Fatal("probe not allowed once the open timeout has passed")
+	}
+	b.record(early, true)
+	if _, ok := b.allow(); ok {
+		t.Error("second probe allowed after a late failure from before the breaker opened")
+	}
+	b.release(early)
+	if _, ok := b.allow(); ok {
+		t.Error("second probe allowed after a late lookup from before the breaker opened was released")
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/gorilla/mux"
+	"purecloudwebservice/datadip"
+)
+
+// newDataDip builds the backends described by cfg and the route each implemented action is answered by.
+func newDataDip(cfg *config) (*dataDip, error) {
+	return rebuildDataDip(cfg, nil, nil)
+}
+
+// rebuildDataDip is newDataDip for a configuration reloaded while prev, built from old, is in use. Backends whose
+// settings, and those of the backends they combine, are unchanged are kept along with their circuit breakers and
+// bulkheads, and so are the caches of actions whose backend and cache settings are unchanged. prev may be nil.
+func rebuildDataDip(cfg *config, old *config, prev *dataDip) (*dataDip, error) {
+	var err error
+
+	var d = &dataDip{routes: make(map[string]route)}
+	var backends map[string]datadip.CaseStore
+	var reread map[*fileStore]*storeFile
+	if backends, reread, err = d.newBackends(cfg, old, prev); err != nil {
+		return nil, err
+	}
+	d.store = newCoalescingStore(backends[cfg.Backend])
+	if cfg.Audit != nil {
+		if d.audit, err = openAuditLog(cfg.Audit.File); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Record != nil {
+		if d.recorder, err = openTrafficRecorder(cfg.Record.File); err != nil {
+			return nil, err
+		}
+	}
+	if len(cfg.Rules) > 0 {
+		if d.rules, err = newRuleSet(cfg.Rules); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, info := range datadip.Actions {
+		if !info.Implemented {
+			continue
+		}
+		var name = info.Name
+		var a = cfg.Actions[name]
+		var backend = cfg.Backend
+		if a.Backend != "" {
+			backend = a.Backend
+		}
+
+		// Concurrent identical lookups share a single backend call, and results may be cached
+		var store datadip.CaseStore
+		if prev != nil && prev.backends[backend] == backends[backend] && old.actionBackend(name) == backend &&
+			reflect.DeepEqual(old.Actions[name].Cache, a.Cache) {
+			store = prev.routes[name].store
+		} else {
+			store = newCoalescingStore(backends[backend])
+			if a.Cache != nil {
+				store = newCacheStore(name, store, time.Duration(a.Cache.TTL), a.Cache.MaxEntries)
+			}
+		}
+
+		var timeout = datadip.DefaultTimeout
+		if a.Timeout > 0 {
+			timeout = time.Duration(a.Timeout)
+		}
+		var rt = route{store: store, timeout: timeout}
+		if rt.validation, err = a.Validation.validation(); err != nil {
+			return nil, fmt.Errorf("actions.%s: validation.%s", name, err)
+		}
+		if a.CustomAttribute != "" {
+			if rt.customAttribute, err = parseCustomAttribute(info, a.CustomAttribute); err != nil {
+				return nil, fmt.Errorf("actions.%s: customAttribute: %s", name, err)
+			}
+		}
+		d.routes[name] = rt
+	}
+
+	// The file stores kept are shared with prev, so they only answer from their files as they are now once nothing
+	// else can fail
+	for fs, data := range reread {
+		fs.replace(data)
+	}
+	return d, nil
+}
+
+// newBackends builds every backend in cfg, returning them by name. Sample and file backends are wrapped so that
+// failed lookups are retried, a circuit breaker fails fast while the backend is unhealthy and a bulkhead limits
+// concurrent lookups against it. Their circuit breakers and bulkheads, and the file stores of file backends, are kept
+// in d. Backends of prev, built from old, that are unchanged in cfg are reused. The files of those that are file
+// backends are read again, and returned by file store for the caller to swap in once the rest of the build has
+// succeeded. cfg must have been validated.
+func (d *dataDip) newBackends(cfg *config, old *config, prev *dataDip) (map[string]datadip.CaseStore, map[*fileStore]*storeFile, error) {
+	var configs = make(map[string]backendConfig)
+	for _, b := range cfg.Backends {
+		configs[b.Name] = b
+	}
+	var oldConfigs = make(map[string]backendConfig)
+	if old != nil {
+		for _, b := range old.Backends {
+			oldConfigs[b.Name] = b
+		}
+	}
+	var unchanged func(name string) bool
+	unchanged = func(name string) bool {
+		var o, ok = oldConfigs[name]
+		if !ok || !reflect.DeepEqual(o, configs[name]) {
+			return false
+		}
+		for _, ref := range configs[name].references() {
+			if !unchanged(ref) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var backends = make(map[string]datadip.CaseStore)
+	var reread = make(map[*fileStore]*storeFile)
+	d.files = make(map[string]*fileStore)
+	d.breakers = make(map[string]*circuitBreaker)
+	d.bulkheads = make(map[string]*bulkheadStore)
+	var build func(name string) (datadip.CaseStore, error)
+	build = func(name string) (datadip.CaseStore, error) {
+		if s, ok := backends[name]; ok {
+			return s, nil
+		}
+		var err error
+		var b = configs[name]
+		var s datadip.CaseStore
+
+		if prev != nil && prev.backends[name] != nil && unchanged(name) {
+			if fs, ok := prev.files[name]; ok {
+				if reread[fs], err = fs.reread(); err != nil {
+					return nil, fmt.Errorf("backend %q: %s", name, err)
+				}
+				d.files[name] = fs
+			}
+			if breaker, ok := prev.breakers[name]; ok {
+				d.breakers[name] = breaker
+				d.bulkheads[name] = prev.bulkheads[name]
+			}
+			backends[name] = prev.backends[name]
+			return backends[name], nil
+		}
+
+		switch b.Type {
+		case backendSample:
+			s = sampleStore{}
+		case backendFile:
+			var fs *fileStore
+			if fs, err = newFileStore(b.File, b.FieldMappings); err != nil {
+				return nil, fmt.Errorf("backend %q: %s", name, err)
+			}
+			d.files[name] = fs
+			s = fs
+		case backendComposite:
+			var members []compositeMember
+			for _, m := range b.Members {
+				var ms datadip.CaseStore
+				if ms, err = build(m); err != nil {
+					return nil, err
+				}
+				members = append(members, compositeMember{Name: m, Store: ms})
+			}
+			s = newCompositeStore(members, b.Fields, time.Duration(b.MergeTimeout))
+		case backendFailover:
+			var primary, secondary datadip.CaseStore
+			if primary, err = build(b.Primary); err != nil {
+				return nil, err
+			}
+			if secondary, err = build(b.Secondary); err != nil {
+				return nil, err
+			}
+			s = newFailoverStore(name, primary, secondary, time.Duration(b.PrimaryTimeout), time.Duration(b.HedgeDelay))
+		case backendShadow:
+			var primary, shadow datadip.CaseStore
+			if primary, err = build(b.Primary); err != nil {
+				return nil, err
+			}
+			if shadow, err = build(b.Shadow); err != nil {
+				return nil, err
+			}
+			var timeout = datadip.DefaultTimeout
+			if b.ShadowTimeout > 0 {
+				timeout = time.Duration(b.ShadowTimeout)
+			}
+			s = newShadowStore(name, primary, shadow, timeout)
+		default:
+			return nil, fmt.Errorf("backend %q: unknown type %q", name, b.Type)
+		}
+
+		if b.Type == backendSample || b.Type == backendFile {
+			s = newRetryingStore(name, s, b.retryPolicy())
+			var bs = newBreakerStore(s, b.breakerSettings())
+			var bh = newBulkheadStore(bs, b.bulkheadSettings())
+			d.breakers[name] = bs.breaker
+			d.bulkheads[name] = bh
+			s = bh
+		}
+		backends[name] = s
+		return s, nil
+	}
+
+	for _, b := range cfg.Backends {
+		if _, err := build(b.Name); err != nil {
+			return nil, nil, err
+		}
+	}
+	d.backends = backends
+	d.shadowOnly = cfg.shadowOnlyBackends()
+	return backends, reread, nil
+}
+
+// actionBackend returns the name of the backend action is answered from, or "" if c is nil.
+func (c *config) actionBackend(action string) string {
+	if c == nil {
+		return ""
+	}
+	if b := c.Actions[action].Backend; b != "" {
+		return b
+	}
+	return c.Backend
+}
+
+// retryPolicy returns the backend's retry policy, or the default one.
+func (b backendConfig) retryPolicy() retryPolicy {
+	if b.Retry == nil {
+		return defaultRetryPolicy
+	}
+	return retryPolicy{Attempts: b.Retry.Attempts, BaseDelay: time.Duration(b.Retry.BaseDelay), MaxDelay: time.Duration(b.Retry.MaxDelay)}
+}
+
+// breakerSettings returns the backend's circuit breaker settings, or the default ones.
+func (b backendConfig) breakerSettings() breakerSettings {
+	if b.Breaker == nil {
+		return defaultBreakerSettings
+	}
+	return breakerSettings{FailureThreshold: b.Breaker.FailureThreshold, OpenTimeout: time.Duration(b.Breaker.OpenTimeout)}
+}
+
+// bulkheadSettings returns the backend's bulkhead settings, or the default ones.
+func (b backendConfig) bulkheadSettings() bulkheadSettings {
+	if b.Bulkhead == nil {
+		return defaultBulkheadSettings
+	}
+	return bulkheadSettings{MaxConcurrent: b.Bulkhead.MaxConcurrent, MaxQueue: b.Bulkhead.MaxQueue}
+}
+
+// handler returns the data dip handler for d, answering and checking each action as its route says, setting the
+// CustomAttribute from d's rules and the action's template and wrapping it in middleware.
+func (d *dataDip) handler(middleware ...datadip.Middleware) *datadip.Handler {
+	var options = []datadip.Option{datadip.WithMiddleware(middleware...)}
+	for name, rt := range d.routes {
+		options = append(options, datadip.WithRoute(name, rt.store, rt.timeout))
+		options = append(options, datadip.WithValidation(name, rt.validation))
+		if d.rules != nil || rt.customAttribute != nil {
+			options = append(options, datadip.WithDecorator(name, customAttributeDecorator(name, d.rules, rt.customAttribute)))
+		}
+	}
+	return datadip.NewHandler(d.store, options...)
+}
+
+// auditing returns the middleware that audits lookups, if d has an audit log. It is for lookups made other than by the
+// connector, which are audited but not kept for the admin console and live tail.
+func (d *dataDip) auditing() []datadip.Middleware {
+	if d.audit == nil {
+		return nil
+	}
+	return []datadip.Middleware{recordLookups(d.audit.add)}
+}
+
+// newRouter returns the HTTP router for d. Every route except /readyz requires the users in cfg, if any. The admin API
+// is served under /admin, with its own users, unless it has its own listen address.
+func newRouter(cfg *config, d *dataDip) *mux.Router {
+	var users = make(map[string]string)
+	if cfg.Auth != nil {
+		for _, u := range cfg.Auth.Users {
+			users[u.Username] = u.Password
+		}
+	}
+	var auth = func(action string, h http.Handler) http.Handler {
+		return requireBasicAuth(users, h)
+	}
+
+	// The actions are answered by the data dip handler and kept for the admin console and live tail, audited, and
+	// recorded for replay if asked to
+	var record = []func(lookupRecord){recentLookups.add}
+	if d.audit != nil {
+		record = append(record, d.audit.add)
+	}
+	var middleware = []datadip.Middleware{auth, recordLookups(record...)}
+	if d.recorder != nil {
+		middleware = append(middleware, recordTraffic(d.recorder))
+	}
+	var h = d.handler(middleware...)
+	// Lookups made other than by the connector, previews and batches, are only audited
+	var others = d.handler(d.auditing()...)
+
+	var r *mux.Router
+	r = mux.NewRouter()
+	r.HandleFunc("/readyz", readyz).Methods("GET")
+	r.Handle("/debug/vars", auth("", expvar.Handler())).Methods("GET")
+	r.Handle("/debug/metadata/{action}", auth("", datadip.PreviewHandler(others))).Methods("POST")
+	r.Handle("/debug/tail", auth("", http.HandlerFunc(tail))).Methods("GET")
+	r.Handle("/actions", auth("", discovery(cfg, d))).Methods("GET")
+	r.Handle("/batch/{action}", auth("", newBatchHandler(cfg, others))).Methods("POST")
+	if cfg.Admin != nil && cfg.Admin.Listen == "" {
+		r.PathPrefix("/admin/").Handler(newAdminRouter(cfg, d))
+	}
+	r.PathPrefix("/").Handler(h)
+	return r
+}
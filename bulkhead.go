@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"sync"
+	"time"
+
+	"purecloudwebservice/datadip"
+)
+
+// bulkheadSettings limits how many lookups may be in flight against one backend at a time and how many more may
+// queue waiting for a free slot.
+type bulkheadSettings struct {
+	MaxConcurrent int
+	MaxQueue      int
+}
+
+// defaultBulkheadSettings is used for backends that do not set their own bulkhead settings
+var defaultBulkheadSettings = bulkheadSettings{MaxConcurrent: 16, MaxQueue: 64}
+
+// bulkheads holds the bulkhead of every backend in use by backend name, so that metrics can find them
+var bulkheads = struct {
+	sync.Mutex
+	m map[string]*bulkheadStore
+}{m: make(map[string]*bulkheadStore)}
+
+func init() {
+	// Expose in-flight, queued and shed lookup counts of every bulkhead in use by backend name
+	expvar.Publish("bulkheads", expvar.Func(func() interface{} {
+		bulkheads.Lock()
+		defer bulkheads.Unlock()
+		var counts = make(map[string]map[string]int64, len(bulkheads.m))
+		for name, s := range bulkheads.m {
+			counts[name] = map[string]int64{"inFlight": s.inFlight.Value(), "queued": int64(s.queuedLookups()), "shed": s.shed.Value()}
+		}
+		return counts
+	}))
+}
+
+// setBulkheads replaces the bulkheads in use with m, which holds them by backend name.
+func setBulkheads(m map[string]*bulkheadStore) {
+	bulkheads.Lock()
+	bulkheads.m = m
+	bulkheads.Unlock()
+}
+
+// bulkheadStore wraps a Store so that one slow backend cannot tie up every handler goroutine. At most MaxConcurrent
+// lookups run against the backend and at most MaxQueue more wait for a slot. A lookup is shed with ErrUnavailable,
+// so the handler replies with its fallback straight away, when the queue is full or when the expected wait plus the
+// backend's recent latency would take it past its deadline.
+type bulkheadStore struct {
+	backend  datadip.CaseStore
+	settings bulkheadSettings
+	slots    chan struct{}
+
+	mu      sync.Mutex
+	queued  int
+	latency time.Duration
+
+	inFlight expvar.Int
+	shed     expvar.Int
+}
+
+// newBulkheadStore returns a Store that limits concurrent lookups against backend.
+func newBulkheadStore(backend datadip.CaseStore, settings bulkheadSettings) *bulkheadStore {
+	if settings.MaxConcurrent < 1 {
+		settings.MaxConcurrent = 1
+	}
+	return &bulkheadStore{backend: backend, settings: settings, slots: make(chan struct{}, settings.MaxConcurrent)}
+}
+
+// GetAccountByAccountNumber looks up an account once a slot against the backend is free.
+func (s *bulkheadStore) GetAccountByAccountNumber(ctx context.Context, accountNumber string) (*datadip.Account, error) {
+	var account *datadip.Account
+	var err = s.do(ctx, func() error {
+		var err error
+		account, err = s.backend.GetAccountByAccountNumber(ctx, accountNumber)
+		return err
+	})
+	return account, err
+}
+
+// GetContactByPhoneNumber looks up a contact once a slot against the backend is free.
+func (s *bulkheadStore) GetContactByPhoneNumber(ctx context.Context, phoneNumber string) (*datadip.Contact, error) {
+	var contact *datadip.Contact
+	var err = s.do(ctx, func() error {
+		var err error
+		contact, err = s.backend.GetContactByPhoneNumber(ctx, phoneNumber)
+		return err
+	})
+	return contact, err
+}
+
+// GetMostRecentOpenCaseByContactID looks up a case once a slot against the backend is free.
+func (s *bulkheadStore) GetMostRecentOpenCaseByContactID(ctx context.Context, contactID string) (*datadip.Case, error) {
+	var c *datadip.Case
+	var err = s.do(ctx, func() error {
+		var err error
+		c, err = s.backend.GetMostRecentOpenCaseByContactID(ctx, contactID)
+		return err
+	})
+	return c, err
+}
+
+// do waits for a free slot, unless the lookup should be shed, and then calls fn.
+func (s *bulkheadStore) do(ctx context.Context, fn func() error) error {
+	// Take a free slot straight away if there is one
+	select {
+	case s.slots <- struct{}{}:
+		return s.call(fn)
+	default:
+	}
+
+	// Otherwise queue for one, unless that is hopeless
+	s.mu.Lock()
+	if s.queued >= s.settings.MaxQueue || s.wouldMissDeadline(ctx) {
+		s.mu.Unlock()
+		s.shed.Add(1)
+		return datadip.ErrUnavailable
+	}
+	s.queued++
+	s.mu.Unlock()
+
+	var err error
+	select {
+	case s.slots <- struct{}{}:
+		s.dequeue()
+		err = s.call(fn)
+	case <-ctx.Done():
+		s.dequeue()
+		s.shed.Add(1)
+		err = datadip.ErrUnavailable
+	}
+	return err
+}
+
+// wouldMissDeadline reports whether a lookup joining the queue now is expected to finish after ctx's deadline. The
+// expected wait assumes queued lookups drain MaxConcurrent at a time, each taking the backend's recent latency.
+// s.mu must be held.
+func (s *bulkheadStore) wouldMissDeadline(ctx context.Context) bool {
+	var deadline, ok = ctx.Deadline()
+	if !ok || s.latency == 0 {
+		return false
+	}
+	var rounds = s.queued/s.settings.MaxConcurrent + 1
+	var expected = time.Duration(rounds+1) * s.latency
+	return time.Now().Add(expected).After(deadline)
+}
+
+// queuedLookups returns how many lookups are waiting for a slot.
+func (s *bulkheadStore) queuedLookups() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queued
+}
+
+// dequeue removes a lookup from the queue count.
+func (s *bulkheadStore) dequeue() {
+	s.mu.Lock()
+	s.queued--
+	s.mu.Unlock()
+}
+
+// call runs fn in a slot that has already been taken and frees the slot afterwards, folding fn's latency into the
+// moving average used to predict queue waits.
+func (s *bulkheadStore) call(fn func() error) error {
+	s.inFlight.Add(1)
+	var start = time.Now()
+	var err = fn()
+	var elapsed = time.Since(start)
+	s.inFlight.Add(-1)
+	<-s.slots
+
+	s.mu.Lock()
+	if s.latency == 0 {
+		s.latency = elapsed
+	} else {
+		s.latency += (elapsed - s.latency) / 8
+	}
+	s.mu.Unlock()
+	return err
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"purecloudwebservice/datadip"
+	"purecloudwebservice/datadip/datadiptest"
+)
+
+func TestBulkheadStore(t *testing.T) {
+	var started = make(chan string, 4)
+	var release = make(chan struct{})
+	var backend = datadiptest.NewStore()
+	backend.Hook = func(ctx context.Context, key string) error {
+		started <- key
+		<-release
+		return nil
+	}
+	var s = newBulkheadStore(backend, bulkheadSettings{MaxConcurrent: 1, MaxQueue: 1})
+
+	var errs = make(chan error, 2)
+	var lookup = func() {
+		var _, err = s.GetAccountByAccountNumber(context.Background(), "123")
+		errs <- err
+	}
+	go lookup()
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("first lookup did not start")
+	}
+	go lookup()
+	var deadline = time.Now().Add(time.Second)
+	for s.queuedLookups() < 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("second lookup did not queue")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// With the slot taken and the queue full, further lookups are shed straight away
+	if _, err := s.GetContactByPhoneNumber(context.Background(), "+60327763333"); err != datadip.ErrUnavailable {
+		t.Errorf("lookup with a full queue: err = %v, want %v", err, datadip.ErrUnavailable)
+	}
+	if n := s.shed.Value(); n != 1 {
+		t.Errorf("shed = %d, want 1", n)
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("admitted lookup: err = %v", err)
+		}
+	}
+	if n := backend.Calls(); n != 2 {
+		t.Errorf("backend calls = %d, want 2", n)
+	}
+}
+
+func TestBulkheadDeadline(t *testing.T) {
+	var release = make(chan struct{})
+	var backend = datadiptest.NewStore()
+	backend.Hook = func(ctx context.Context, key string) error {
+		<-release
+		return nil
+	}
+	defer close(release)
+	var s = newBulkheadStore(backend, bulkheadSettings{MaxConcurrent: 1, MaxQueue: 10})
+	s.slots <- struct{}{}
+
+	var tests = []struct {
+		name      string
+		latency   time.Duration
+		timeout   time.Duration
+		immediate bool
+	}{
+		// The backend answers in 100ms, so waiting for the slot cannot finish within 50ms
+		{"expected to miss its deadline", 100 * time.Millisecond, 50 * time.Millisecond, true},
+		// The lookup queues, but its deadline passes before the slot frees up
+		{"deadline passes in the queue", time.Millisecond, 20 * time.Millisecond, false},
+	}
+	for _, tt := range tests {
+		s.mu.Lock()
+		s.latency = tt.latency
+		s.mu.Unlock()
+		var ctx, cancel = context.WithTimeout(context.Background(), tt.timeout)
+		var start = time.Now()
+		var _, err = s.GetAccountByAccountNumber(ctx, "123")
+		cancel()
+		if err != datadip.ErrUnavailable || (tt.immediate && time.Since(start) >= tt.timeout) {
+			t.Errorf("%s: err = %v after %s, want %v", tt.name, err, time.Since(start), datadip.ErrUnavailable)
+		}
+	}
+	if n := s.queuedLookups(); n != 0 {
+		t.Errorf("queued = %d after shedding, want 0", n)
+	}
+}
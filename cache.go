@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"sync"
+	"time"
+
+	"purecloudwebservice/datadip"
+)
+
+// cacheStats counts cache hits and misses by action name
+var cacheStats = expvar.NewMap("cache")
+
+// cacheStore wraps a Store and remembers lookup results, including records not found, for a while. Errors other than
+// ErrNotFound are not cached.
+type cacheStore struct {
+	name       string
+	backend    datadip.CaseStore
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// cacheEntry is a remembered lookup result
+type cacheEntry struct {
+	val     interface{}
+	err     error
+	expires time.Time
+}
+
+// newCacheStore returns a Store that caches lookups made against backend for ttl, keeping at most maxEntries results
+// if maxEntries is positive. Hits and misses are counted under name.
+func newCacheStore(name string, backend datadip.CaseStore, ttl time.Duration, maxEntries int) *cacheStore {
+	return &cacheStore{name: name, backend: backend, ttl: ttl, maxEntries: maxEntries, entries: make(map[string]cacheEntry)}
+}
+
+// GetAccountByAccountNumber returns a cached account or looks it up.
+func (s *cacheStore) GetAccountByAccountNumber(ctx context.Context, accountNumber string) (*datadip.Account, error) {
+	var v, err = s.do("account:"+accountNumber, func() (interface{}, error) {
+		return s.backend.GetAccountByAccountNumber(ctx, accountNumber)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*datadip.Account), nil
+}
+
+// GetContactByPhoneNumber returns a cached contact or looks it up.
+func (s *cacheStore) GetContactByPhoneNumber(ctx context.Context, phoneNumber string) (*datadip.Contact, error) {
+	var v, err = s.do("contact:"+phoneNumber, func() (interface{}, error) {
+		return s.backend.GetContactByPhoneNumber(ctx, phoneNumber)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*datadip.Contact), nil
+}
+
+// GetMostRecentOpenCaseByContactID returns a cached case or looks it up.
+func (s *cacheStore) GetMostRecentOpenCaseByContactID(ctx context.Context, contactID string) (*datadip.Case, error) {
+	var v, err = s.do("case:"+contactID, func() (interface{}, error) {
+		return s.backend.GetMostRecentOpenCaseByContactID(ctx, contactID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*datadip.Case), nil
+}
+
+// do returns the cached result for key if it has not expired, or else calls fn and caches what it returns.
+func (s *cacheStore) do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	var now = time.Now()
+	s.mu.Lock()
+	var e, ok = s.entries[key]
+	s.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		cacheStats.Add(s.name+".hits", 1)
+		return e.val, e.err
+	}
+	cacheStats.Add(s.name+".misses", 1)
+
+	var v, err = fn()
+	if err != nil && err != datadip.ErrNotFound {
+		return v, err
+	}
+
+	s.mu.Lock()
+	if s.maxEntries > 0 && len(s.entries) >= s.maxEntries {
+		s.evict(now)
+	}
+	s.entries[key] = cacheEntry{val: v, err: err, expires: now.Add(s.ttl)}
+	s.mu.Unlock()
+	return v, err
+}
+
+// evict makes room for a new entry by dropping expired entries, or an arbitrary entry if none have expired. s.mu must
+// be held.
+func (s *cacheStore) evict(now time.Time) {
+	for key, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, key)
+		}
+	}
+	for key := range s.entries {
+		if len(s.entries) < s.maxEntries {
+			break
+		}
+		delete(s.entries, key)
+	}
+}
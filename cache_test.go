@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"purecloudwebservice/datadip"
+	"purecloudwebservice/datadip/datadiptest"
+)
+
+func TestCacheStore(t *testing.T) {
+	var crmDown = errors.New("crm down")
+	var backend = datadiptest.NewStore()
+	var s = newCacheStore("test", backend, 50*time.Millisecond, 0)
+	var ctx = context.Background()
+
+	var steps = []struct {
+		name  string
+		key   string
+		fail  error
+		wait  time.Duration
+		err   error
+		calls int
+	}{
+		{"miss", "123", nil, 0, nil, 1},
+		{"hit", "123", nil, 0, nil, 1},
+		{"not found is cached", "999", nil, 0, datadip.ErrNotFound, 2},
+		{"not found hit", "999", nil, 0, datadip.ErrNotFound, 2},
+		{"expired", "123", nil, 60 * time.Millisecond, nil, 3},
+		{"error is not cached", "456", crmDown, 0, crmDown, 4},
+		{"after an error", "456", nil, 0, datadip.ErrNotFound, 5},
+	}
+	for _, st := range steps {
+		time.Sleep(st.wait)
+		backend.Err = st.fail
+		if _, err := s.GetAccountByAccountNumber(ctx, st.key); err != st.err {
+			t.Errorf("%s: err = %v, want %v", st.name, err, st.err)
+		}
+		if n := backend.Calls(); n != st.calls {
+			t.Errorf("%s: backend calls = %d, want %d", st.name, n, st.calls)
+		}
+	}
+
+	// Accounts and contacts are cached separately
+	if _, err := s.GetContactByPhoneNumber(ctx, "123"); err != datadip.ErrNotFound || backend.Calls() != 6 {
+		t.Errorf("contact: err = %v, backend calls = %d", err, backend.Calls())
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	var backend = datadiptest.NewStore()
+	var s = newCacheStore("test", backend, time.Hour, 2)
+	var ctx = context.Background()
+
+	for _, key := range []string{"1", "2", "3", "4"} {
+		s.GetAccountByAccountNumber(ctx, key)
+		if n := len(s.entries); n > 2 {
+			t.Fatalf("%d entries after looking up %s, want at most 2", n, key)
+		}
+	}
+
+	// Expired entries are evicted before live ones
+	s.entries = map[string]cacheEntry{
+		"account:old":  {err: datadip.ErrNotFound, expires: time.Now().Add(-time.Second)},
+		"account:live": {err: datadip.ErrNotFound, expires: time.Now().Add(time.Hour)},
+	}
+	s.GetAccountByAccountNumber(ctx, "123")
+	if _, ok := s.entries["account:live"]; !ok || len(s.entries) != 2 {
+		t.Errorf("entries = %v, want the live entry and the new one", s.entries)
+	}
+}
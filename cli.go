@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"purecloudwebservice/datadip"
+)
+
+// command is a subcommand of the purecloudwebservice binary
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) int
+}
+
+// commands lists every subcommand. Each run function returns the process exit code
+var commands = []command{
+	{"serve", "[-config file]  run the data dip web service (the default)", serve},
+	{"lookup", "[-config file] [-body json] action [key]  print the response the connector would receive", lookup},
+	{"import", "[-config file] [-backend name] datafile...  load accounts, contacts and cases into a file backend", importData},
+	{"simulate", "[-url url] [-user name -password secret] [-timeout d] action key  call a running service like the connector", simulate},
+	{"schema", "[action...]  print the JSON Schema of each action's request and response", printSchema},
+	{"expressions", "[-prefix Flow.] [action...]  print safe Architect expressions for every response field", printExpressions},
+	{"validate-config", "[-config file]  check a configuration file and report every problem", validateConfig},
+	{"rules", "test [-config file] [-at time] [-response json] action [key]  show how the rules and template set an action's CustomAttribute", rules},
+	{"replay", "[-config file | -url url] recording  send recorded traffic again and report replies that differ", replay},
+	{"verify-audit", "[-config file] [auditfile]  check that an audit log has not been tampered with", verifyAuditLog},
+}
+
+// usage prints the subcommands to stderr.
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: purecloudwebservice [command] [arguments]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %s %s\n", c.name, c.usage)
+	}
+}
+
+// lookup runs the lookup subcommand with args. It sends an action's request through the same handler the server
+// uses, against the configured backends, and prints the response body. The request body is given with -body, or
+// built from the lookup key. Authentication is skipped.
+func lookup(args []string) int {
+	var flags = flag.NewFlagSet("lookup", flag.ExitOnError)
+	var configFlag = flags.String("config", "", "configuration file, defaults to $"+configEnv)
+	var body = flags.String("body", "", "request body to send instead of one built from the key")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 || (*body == "" && flags.NArg() < 2) {
+		fmt.Fprintln(os.Stderr, "Usage: purecloudwebservice lookup [-config file] [-body json] action [key]")
+		return 2
+	}
+	var info, ok = datadip.FindAction(flags.Arg(0))
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown action %q\n", flags.Arg(0))
+		return 2
+	}
+	if *body == "" {
+		var b, _ = json.Marshal(map[string]string{info.KeyField: flags.Arg(1)})
+		*body = string(b)
+	}
+
+	var err error
+	var cfg *config
+	if cfg, err = loadOfflineConfig(configPath(*configFlag)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	var d *dataDip
+	if d, err = newDataDip(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	cfg.Auth = nil
+
+	var rec = datadip.NewRecorder()
+	newRouter(cfg, d).ServeHTTP(rec, actionRequest(context.Background(), info.Name, []byte(*body)))
+
+	fmt.Fprintf(os.Stderr, "HTTP %d %s\n", rec.Status, http.StatusText(rec.Status))
+	os.Stdout.Write(rec.Body.Bytes())
+	if rec.Body.Len() > 0 && rec.Body.Bytes()[rec.Body.Len()-1] != '\n' {
+		fmt.Println()
+	}
+	if rec.Status != http.StatusOK {
+		return 1
+	}
+	return 0
+}
+
+// loadOfflineConfig loads the configuration file at path like loadConfig, for commands that make lookups of their own.
+// A running server keeps the head of the audit chain in memory, so lookups from another process must not be appended
+// to the audit log, nor recorded as the connector's traffic; the configuration returned has neither.
+func loadOfflineConfig(path string) (*config, error) {
+	var cfg, err = loadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Audit = nil
+	cfg.Record = nil
+	return cfg, nil
+}
+
+// importData runs the import subcommand with args. It merges the accounts, contacts and cases in each data file, laid
+// out like a file backend's file, into a file backend. Running servers see the new data once their configuration is
+// reloaded.
+func importData(args []string) int {
+	var flags = flag.NewFlagSet("import", flag.ExitOnError)
+	var configFlag = flags.String("config", "", "configuration file, defaults to $"+configEnv)
+	var backendFlag = flags.String("backend", "", "file backend to import into, defaults to the default backend")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: purecloudwebservice import [-config file] [-backend name] datafile...")
+		return 2
+	}
+
+	var err error
+	var cfg *config
+	if cfg, err = loadConfig(configPath(*configFlag)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	var name = cfg.Backend
+	if *backendFlag != "" {
+		name = *backendFlag
+	}
+	var target *backendConfig
+	for i := range cfg.Backends {
+		if cfg.Backends[i].Name == name {
+			target = &cfg.Backends[i]
+		}
+	}
+	if target == nil || target.Type != backendFile {
+		fmt.Fprintf(os.Stderr, "Backend %q is not a file backend\n", name)
+		return 1
+	}
+
+	var data *storeFile
+	if data, err = readStoreFile(target.File, target.FieldMappings); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	for _, path := range flags.Args() {
+		var other *storeFile
+		if other, err = readStoreFile(path, target.FieldMappings); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		var accounts, contacts, cases = data.merge(other)
+		fmt.Printf("%s: %d accounts, %d contacts, %d cases\n", path, accounts, contacts, cases)
+	}
+	if err = writeStoreFile(target.File, data, target.FieldMappings); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("Imported into %s (%s)\n", name, target.File)
+	return 0
+}
+
+// printSchema runs the schema subcommand with args, printing the JSON Schema of the request and response of each
+// action named, or of every implemented action.
+func printSchema(args []string) int {
+	var flags = flag.NewFlagSet("schema", flag.ExitOnError)
+	flags.Parse(args)
+
+	var names = flags.Args()
+	if len(names) == 0 {
+		for _, a := range datadip.Actions {
+			if a.Implemented {
+				names = append(names, a.Name)
+			}
+		}
+	}
+
+	var schemas = make(map[string]interface{})
+	for _, name := range names {
+		var info, ok = datadip.FindAction(name)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Unknown action %q\n", name)
+			return 2
+		}
+		if !info.Implemented {
+			fmt.Fprintf(os.Stderr, "Action %s is not implemented\n", name)
+			return 1
+		}
+		schemas[name] = map[string]interface{}{"request": datadip.JSONSchema(info.Request), "response": datadip.JSONSchema(info.Response)}
+	}
+
+	var b, _ = json.MarshalIndent(schemas, "", "  ")
+	fmt.Println(string(b))
+	return 0
+}
+
+// validateConfig runs the validate-config subcommand with args, printing every problem found in the configuration
+// file. It returns the process exit code.
+func validateConfig(args []string) int {
+	var flags = flag.NewFlagSet("validate-config", flag.ExitOnError)
+	var configFlag = flags.String("config", "", "configuration file, defaults to $"+configEnv)
+	flags.Parse(args)
+
+	var path = configPath(*configFlag)
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "validate-config: no configuration file given, use -config or $"+configEnv)
+		return 2
+	}
+	if _, err := loadConfig(path); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("%s is valid\n", path)
+	return 0
+}
+
+// verifyAuditLog runs the verify-audit subcommand with args. It checks the hash chain of the audit file named, or of
+// the configured one, and reports the first entry that has been changed, removed or reordered.
+func verifyAuditLog(args []string) int {
+	var flags = flag.NewFlagSet("verify-audit", flag.ExitOnError)
+	var configFlag = flags.String("config", "", "configuration file, defaults to $"+configEnv)
+	flags.Parse(args)
+
+	var path = flags.Arg(0)
+	if path == "" {
+		var cfg, err = loadConfig(configPath(*configFlag))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if cfg.Audit == nil {
+			fmt.Fprintln(os.Stderr, "Usage: purecloudwebservice verify-audit [-config file] [auditfile]")
+			fmt.Fprintln(os.Stderr, "No audit file given and none is configured")
+			return 2
+		}
+		path = cfg.Audit.File
+	}
+
+	var f, err = os.Open(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer f.Close()
+	var count, last, verr = verifyAudit(f)
+	if verr != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", path, verr)
+		fmt.Fprintf(os.Stderr, "%d entries verified before that\n", count)
+		return 1
+	}
+	fmt.Printf("%s: %d entries verified, last hash %s\n", path, count, last)
+	return 0
+}
+
+// rules runs the rules subcommand with args. Its only subcommand, test, evaluates the configured rules for one lookup
+// and shows which rules matched, which condition stopped the others, and the CustomAttribute that results from them
+// and the action's CustomAttribute template. The response is looked up through the configured backends by key, or
+// given with -response.
+func rules(args []string) int {
+	if len(args) == 0 || args[0] != "test" {
+		fmt.Fprintln(os.Stderr, "Usage: purecloudwebservice rules test [-config file] [-at time] [-response json] action [key]")
+		return 2
+	}
+	var flags = flag.NewFlagSet("rules test", flag.ExitOnError)
+	var configFlag = flags.String("config", "", "configuration file, defaults to $"+configEnv)
+	var at = flags.String("at", "", "time to evaluate the rules at, such as 2026-10-18T09:30:00+08:00, defaults to now")
+	var response = flags.String("response", "", "response to evaluate the rules against instead of looking it up")
+	flags.Parse(args[1:])
+
+	if flags.NArg() < 1 || (*response == "" && flags.NArg() < 2) {
+		fmt.Fprintln(os.Stderr, "Usage: purecloudwebservice rules test [-config file] [-at time] [-response json] action [key]")
+		return 2
+	}
+	var info, ok = datadip.FindAction(flags.Arg(0))
+	if !ok || !info.Implemented {
+		fmt.Fprintf(os.Stderr, "%q is not an implemented action\n", flags.Arg(0))
+		return 2
+	}
+	var err error
+	var now = time.Now()
+	if *at != "" {
+		if now, err = time.Parse(time.RFC3339, *at); err != nil {
+			fmt.Fprintf(os.Stderr, "-at: %s\n", err)
+			return 2
+		}
+	}
+
+	var cfg *config
+	if cfg, err = loadOfflineConfig(configPath(*configFlag)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	var d *dataDip
+	if d, err = newDataDip(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	var rs, tmpl = d.rules, d.routes[info.Name].customAttribute
+	if rs == nil && tmpl == nil {
+		fmt.Fprintf(os.Stderr, "No rules or CustomAttribute template are configured for %s\n", info.Name)
+		return 1
+	}
+
+	// The request and the response as the backend gives it, before the rules
+	var b, _ = json.Marshal(map[string]string{info.KeyField: flags.Arg(1)})
+	var req = reflect.New(reflect.TypeOf(info.Request)).Interface()
+	json.Unmarshal(b, req)
+	var body = []byte(*response)
+	if *response == "" {
+		d.rules = nil
+		for name, rt := range d.routes {
+			rt.customAttribute = nil
+			d.routes[name] = rt
+		}
+		var rec = datadip.NewRecorder()
+		d.handler(d.auditing()...).ServeHTTP(rec, actionRequest(context.Background(), info.Name, b))
+		if rec.Status != http.StatusOK {
+			fmt.Fprintf(os.Stderr, "Lookup failed with HTTP %d, the rules are not run: %s\n", rec.Status, strings.TrimSpace(rec.Body.String()))
+			return 1
+		}
+		body = rec.Body.Bytes()
+	}
+	var resp = reflect.New(reflect.TypeOf(info.Response)).Interface()
+	if err = json.Unmarshal(body, resp); err != nil {
+		fmt.Fprintf(os.Stderr, "Response is not a %s: %s\n", reflect.TypeOf(info.Response).Name(), err)
+		return 1
+	}
+	fmt.Printf("Response: %s\n\n", bytes.TrimSpace(body))
+
+	var attrs map[string]string
+	var traces []ruleTrace
+	if rs != nil {
+		attrs, traces = rs.evaluate(info.Name, req, resp, now)
+	}
+	for i, t := range traces {
+		var name = t.rule.Name
+		if name == "" {
+			name = fmt.Sprintf("rules[%d]", i)
+		}
+		switch {
+		case !t.applies:
+			fmt.Printf("%s: skipped, not for %s\n", name, info.Name)
+		case t.failed != nil:
+			fmt.Printf("%s: not matched, %s does not hold\n", name, t.failed)
+		default:
+			fmt.Printf("%s: matched, sets %s\n", name, formatAttributes(t.rule.Set))
+		}
+	}
+	var value string
+	var set bool
+	value, set, err = customAttribute(tmpl, attrs, req, resp)
+	switch {
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "\nThe CustomAttribute template failed, the CustomAttribute is left as the backend returned it: %s\n", err)
+		return 1
+	case !set:
+		fmt.Println("\nNo rule matched, the CustomAttribute is left as the backend returned it")
+	default:
+		fmt.Printf("\nCustomAttribute: %s\n", value)
+	}
+	return 0
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"purecloudwebservice/datadip"
+)
+
+// writeTestFiles writes each file, by name, to dir.
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestImportData(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var crm = filepath.Join(dir, "crm.json")
+	writeTestFiles(t, dir, map[string]string{
+		"config.json": `{"backends": [{"name": "crm", "type": "file", "file": "` + crm + `",
+			"fieldMappings": {"Accounts": {"acct_no": "Number", "display_name": "Name"}}}]}`,
+		"crm.json": `{"Accounts": [{"Id": "1", "acct_no": "123", "display_name": "Old Name"}]}`,
+		"import.json": `{
+			"Accounts": [{"Id": "1", "acct_no": "123", "display_name": "Ng Sze Min"}, {"Id": "4", "acct_no": "456", "display_name": "Added"}],
+			"Contacts": [{"Id": "2", "FullName": "Ng Sze Min"}],
+			"Cases": [{"Id": "5", "ContactId": "2", "Status": "New"}]
+		}`,
+	})
+
+	var code int
+	var out = captureStdout(t, func() {
+		code = importData([]string{"-config", filepath.Join(dir, "config.json"), filepath.Join(dir, "import.json")})
+	})
+	if code != 0 || !strings.Contains(out, "import.json: 2 accounts, 1 contacts, 1 cases") {
+		t.Fatalf("exit code = %d, output:\n%s", code, out)
+	}
+
+	// The backend's file keeps its own field names and holds the imported records
+	var b, _ = ioutil.ReadFile(crm)
+	var file map[string][]map[string]string
+	if err = json.Unmarshal(b, &file); err != nil {
+		t.Fatal(err)
+	}
+	if accounts := file["Accounts"]; len(accounts) != 2 || accounts[0]["acct_no"] != "123" || accounts[0]["display_name"] != "Ng Sze Min" || accounts[1]["acct_no"] != "456" {
+		t.Errorf("accounts = %v", accounts)
+	}
+	if len(file["Contacts"]) != 1 || len(file["Cases"]) != 1 || file["Cases"][0]["Status"] != "New" {
+		t.Errorf("file = %s", b)
+	}
+	var data *storeFile
+	if data, err = readStoreFile(crm, fieldMappings{"Accounts": {"acct_no": "Number", "display_name": "Name"}}); err != nil || data.Accounts[0].Name != "Ng Sze Min" {
+		t.Errorf("reread accounts = %+v, %v", data, err)
+	}
+
+	writeTestFiles(t, dir, map[string]string{"sample.json": `{"backends": [{"name": "sample", "type": "sample"}]}`})
+	if code = importData([]string{"-config", filepath.Join(dir, "sample.json"), filepath.Join(dir, "import.json")}); code != 1 {
+		t.Errorf("import into a sample backend: exit code = %d, want 1", code)
+	}
+}
+
+func TestLookupCommand(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "lookup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var configFile = filepath.Join(dir, "config.json")
+	writeTestFiles(t, dir, map[string]string{
+		"config.json": `{"auth": {"users": [{"username": "purecloud", "password": "secret"}]},
+			"backends": [{"name": "crm", "type": "file", "file": "` + filepath.Join(dir, "crm.json") + `"}]}`,
+		"crm.json": `{"Contacts": [{"Id": "2", "FullName": "Ng Sze Min", "PhoneNumbers": {"PhoneNumber": [{"Number": "+60327763333"}]}}]}`,
+	})
+
+	// Lookups skip authentication, and print the response the connector would get
+	var code int
+	var out = captureStdout(t, func() {
+		code = lookup([]string{"-config", configFile, datadip.ActionGetContactByPhoneNumber, "+60327763333"})
+	})
+	var resp datadip.ContactResponse
+	if code != 0 || json.Unmarshal([]byte(out), &resp) != nil || resp.Contact.FullName != "Ng Sze Min" {
+		t.Errorf("exit code = %d, output %q", code, out)
+	}
+	captureStdout(t, func() {
+		code = lookup([]string{"-config", configFile, "-body", `{"PhoneNumber":"+1"}`, datadip.ActionGetContactByPhoneNumber})
+	})
+	if code != 1 {
+		t.Errorf("lookup not found: exit code = %d, want 1", code)
+	}
+	if code = lookup([]string{"-config", configFile, "GetNothing", "1"}); code != 2 {
+		t.Errorf("unknown action: exit code = %d, want 2", code)
+	}
+}
+
+func TestPrintSchema(t *testing.T) {
+	var code int
+	var out = captureStdout(t, func() {
+		code = printSchema([]string{datadip.ActionGetAccountByAccountNumber})
+	})
+	var schemas map[string]struct {
+		Request  map[string]interface{} `json:"request"`
+		Response map[string]interface{} `json:"response"`
+	}
+	if code != 0 || json.Unmarshal([]byte(out), &schemas) != nil || len(schemas) != 1 {
+		t.Fatalf("exit code = %d, output:\n%s", code, out)
+	}
+	var schema = schemas[datadip.ActionGetAccountByAccountNumber]
+	if props, _ := schema.Request["properties"].(map[string]interface{}); props["AccountNumber"] == nil || schema.Response["properties"] == nil {
+		t.Errorf("schema = %+v", schema)
+	}
+
+	if code = printSchema([]string{datadip.ActionGetAccountByContactID}); code != 1 {
+		t.Errorf("schema of an action not implemented: exit code = %d, want 1", code)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"purecloudwebservice/datadip"
+)
+
+// coalescingStore wraps a Store so that concurrent identical lookups share a single in-flight backend call. The result
+// of that call is fanned out to every caller waiting on it, but each caller still gives up when its own context is
+// done. The backend call is abandoned once nobody is waiting for it any more.
+type coalescingStore struct {
+	backend datadip.CaseStore
+
+	mu    sync.Mutex
+	calls map[string]*inflightCall
+}
+
+// inflightCall is a backend call shared by one or more callers of coalescingStore.
+type inflightCall struct {
+	ctx     *callContext
+	done    chan struct{}
+	val     interface{}
+	err     error
+	waiters int
+}
+
+// callContext is the context a shared backend call runs with. It is detached from every caller, so that no single
+// caller cancelling or running out of time fails the others: it is done once the latest deadline of the callers
+// waiting on the call has passed, or when they have all given up. Its deadline is the latest one so far, and there is
+// none once a caller without a deadline waits on the call.
+type callContext struct {
+	context.Context
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	deadline  time.Time
+	unbounded bool
+	timer     *time.Timer
+}
+
+// newCallContext returns a callContext that no caller is waiting on yet.
+func newCallContext() *callContext {
+	var ctx, cancel = context.WithCancel(context.Background())
+	return &callContext{Context: ctx, cancel: cancel}
+}
+
+// Deadline returns the latest deadline of the callers waiting on the call.
+func (c *callContext) Deadline() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.deadline, !c.unbounded && !c.deadline.IsZero()
+}
+
+// join extends the call to cover the deadline of ctx, a caller that starts waiting on it.
+func (c *callContext) join(ctx context.Context) {
+	var deadline, ok = ctx.Deadline()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case c.unbounded:
+	case !ok:
+		c.unbounded = true
+		if c.timer != nil {
+			c.timer.Stop()
+		}
+	case deadline.After(c.deadline):
+		c.deadline = deadline
+		if c.timer == nil {
+			c.timer = time.AfterFunc(time.Until(deadline), c.cancel)
+		} else {
+			c.timer.Reset(time.Until(deadline))
+		}
+	}
+}
+
+// stop releases the call's timer and cancels it.
+func (c *callContext) stop() {
+	c.mu.Lock()
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.mu.Unlock()
+	c.cancel()
+}
+
+// newCoalescingStore returns a Store that coalesces concurrent identical lookups made against backend.
+func newCoalescingStore(backend datadip.CaseStore) *coalescingStore {
+	return &coalescingStore{backend: backend, calls: make(map[string]*inflightCall)}
+}
+
+// GetAccountByAccountNumber looks up an account, sharing the backend call with concurrent lookups of the same number.
+func (s *coalescingStore) GetAccountByAccountNumber(ctx context.Context, accountNumber string) (*datadip.Account, error) {
+	var v, err = s.do(ctx, "account:"+accountNumber, func(ctx context.Context) (interface{}, error) {
+		return s.backend.GetAccountByAccountNumber(ctx, accountNumber)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*datadip.Account), nil
+}
+
+// GetContactByPhoneNumber looks up a contact, sharing the backend call with concurrent lookups of the same number.
+func (s *coalescingStore) GetContactByPhoneNumber(ctx context.Context, phoneNumber string) (*datadip.Contact, error) {
+	var v, err = s.do(ctx, "contact:"+phoneNumber, func(ctx context.Context) (interface{}, error) {
+		return s.backend.GetContactByPhoneNumber(ctx, phoneNumber)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*datadip.Contact), nil
+}
+
+// GetMostRecentOpenCaseByContactID looks up a case, sharing the backend call with concurrent lookups for the same
+// contact.
+func (s *coalescingStore) GetMostRecentOpenCaseByContactID(ctx context.Context, contactID string) (*datadip.Case, error) {
+	var v, err = s.do(ctx, "case:"+contactID, func(ctx context.Context) (interface{}, error) {
+		return s.backend.GetMostRecentOpenCaseByContactID(ctx, contactID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*datadip.Case), nil
+}
+
+// do runs fn once for all concurrent callers asking for the same key and waits for its result or for ctx to be done,
+// whichever comes first. The shared call runs until the latest deadline of the callers waiting on it and is cancelled
+// when the last of them gives up.
+func (s *coalescingStore) do(ctx context.Context, key string, fn func(context.Context) (interface{}, error)) (interface{}, error) {
+	s.mu.Lock()
+	var c, ok = s.calls[key]
+	// A call whose callers have all run out of time is not joined, even if it has not returned yet
+	var start = !ok || c.ctx.Err() != nil
+	if start {
+		c = &inflightCall{ctx: newCallContext(), done: make(chan struct{})}
+		s.calls[key] = c
+	}
+	c.ctx.join(ctx)
+	c.waiters++
+	s.mu.Unlock()
+
+	if start {
+		go func() {
+			c.val, c.err = fn(c.ctx)
+			s.forget(key, c)
+			c.ctx.stop()
+			close(c.done)
+		}()
+	}
+
+	select {
+	case <-c.done:
+		return c.val, c.err
+	case <-ctx.Done():
+		s.mu.Lock()
+		c.waiters--
+		var abandoned = c.waiters == 0
+		if abandoned && s.calls[key] == c {
+			delete(s.calls, key)
+		}
+		s.mu.Unlock()
+		if abandoned {
+			c.ctx.stop()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// forget removes c from the in-flight calls so that the next lookup for key starts a new backend call.
+func (s *coalescingStore) forget(key string, c *inflightCall) {
+	s.mu.Lock()
+	if s.calls[key] == c {
+		delete(s.calls, key)
+	}
+	s.mu.Unlock()
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"purecloudwebservice/datadip/datadiptest"
+)
+
+func TestCoalescingStore(t *testing.T) {
+	var backend = datadiptest.NewStore()
+	backend.Delay = 50 * time.Millisecond
+	var s = newCoalescingStore(backend)
+
+	// Concurrent lookups of the same key share one backend call, other keys get their own
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if a, err := s.GetAccountByAccountNumber(context.Background(), "123"); err != nil || a.Name != "Ng Sze Min" {
+				t.Errorf("account = %+v, %v", a, err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if c, err := s.GetContactByPhoneNumber(context.Background(), "+60327763333"); err != nil || c.ID != "2" {
+				t.Errorf("contact = %+v, %v", c, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := backend.Calls(); n != 2 {
+		t.Errorf("backend calls = %d, want 2", n)
+	}
+
+	// Once a call has returned, the next lookup makes a new one
+	s.GetAccountByAccountNumber(context.Background(), "123")
+	if n := backend.Calls(); n != 3 {
+		t.Errorf("backend calls = %d, want 3", n)
+	}
+}
+
+func TestCoalescingStoreDetachesCallers(t *testing.T) {
+	var deadlines = make(chan time.Time, 2)
+	var backend = datadiptest.NewStore()
+	backend.Hook = func(ctx context.Context, key string) error {
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		var deadline, _ = ctx.Deadline()
+		deadlines <- deadline
+		return nil
+	}
+	var s = newCoalescingStore(backend)
+
+	// The caller that starts the call gives up first, without failing the caller still waiting
+	var short, cancelShort = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancelShort()
+	var long, cancelLong = context.WithTimeout(context.Background(), time.Second)
+	defer cancelLong()
+	var errs = make(chan error, 1)
+	go func() {
+		var _, err = s.GetAccountByAccountNumber(short, "123")
+		errs <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+	if a, err := s.GetAccountByAccountNumber(long, "123"); err != nil || a.Name != "Ng Sze Min" {
+		t.Errorf("waiting caller: account = %+v, %v", a, err)
+	}
+	if err := <-errs; err != context.DeadlineExceeded {
+		t.Errorf("first caller: err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	var want, _ = long.Deadline()
+	if got := <-deadlines; !got.Equal(want) {
+		t.Errorf("call deadline = %s, want the latest caller deadline %s", got, want)
+	}
+	if n := backend.Calls(); n != 1 {
+		t.Errorf("backend calls = %d, want 1", n)
+	}
+
+	// The call is cancelled once every caller has given up
+	var done = make(chan error, 1)
+	backend.Hook = func(ctx context.Context, key string) error {
+		<-ctx.Done()
+		done <- ctx.Err()
+		return ctx.Err()
+	}
+	var ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := s.GetAccountByAccountNumber(ctx, "123"); err != context.Canceled {
+		t.Errorf("abandoned lookup: err = %v, want %v", err, context.Canceled)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("abandoned backend call was not cancelled")
+	}
+}
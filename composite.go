@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"purecloudwebservice/datadip"
+)
+
+// compositeMergeMargin is how long before the lookup's deadline a compositeStore merges what it has, so that the
+// merged record reaches the caller before the caller gives up
+const compositeMergeMargin = 20 * time.Millisecond
+
+// compositeMember is one of the backends a compositeStore fans lookups out to
+type compositeMember struct {
+	Name  string
+	Store datadip.CaseStore
+}
+
+// compositeStore is a Store for data split across several backends, e.g. identity in a CRM, contact channels in a
+// marketing system and balances in billing. Each lookup goes to every member in parallel and the records found are
+// merged into one.
+//
+// precedence maps a field name, as it appears in the JSON response (e.g. "Name" or "EmailAddresses"), to the member
+// names that may supply it, most trusted first. Members not listed follow in the order they were given. A single
+// valued field is taken from the first member in that order that has it set. EmailAddresses, PhoneNumbers and
+// Addresses are the union of every member's lists in that order, with duplicates removed. Members may hold different
+// cases for a contact, so a case is taken from the first member in the order for Id that found one, and only filled in
+// from members that found a case with the same Id.
+//
+// If mergeTimeout is set, the lookup stops waiting for members after that long and merges what it has. A lookup also
+// merges what it has compositeMergeMargin before ctx's deadline, so members that miss the deadline only leave gaps in
+// the record.
+type compositeStore struct {
+	members      []compositeMember
+	precedence   map[string][]string
+	mergeTimeout time.Duration
+}
+
+// newCompositeStore returns a Store that merges lookups made against members.
+func newCompositeStore(members []compositeMember, precedence map[string][]string, mergeTimeout time.Duration) *compositeStore {
+	return &compositeStore{members: members, precedence: precedence, mergeTimeout: mergeTimeout}
+}
+
+// compositeResult is what one member answered
+type compositeResult struct {
+	name string
+	val  interface{}
+	err  error
+}
+
+// GetAccountByAccountNumber looks up an account in every member and merges what they found.
+func (s *compositeStore) GetAccountByAccountNumber(ctx context.Context, accountNumber string) (*datadip.Account, error) {
+	var found, err = s.fanOut(ctx, func(ctx context.Context, member datadip.CaseStore) (interface{}, error) {
+		return member.GetAccountByAccountNumber(ctx, accountNumber)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var accounts = make(map[string]*datadip.Account, len(found))
+	for name, v := range found {
+		accounts[name] = v.(*datadip.Account)
+	}
+	return s.mergeAccounts(accounts), nil
+}
+
+// GetContactByPhoneNumber looks up a contact in every member and merges what they found.
+func (s *compositeStore) GetContactByPhoneNumber(ctx context.Context, phoneNumber string) (*datadip.Contact, error) {
+	var found, err = s.fanOut(ctx, func(ctx context.Context, member datadip.CaseStore) (interface{}, error) {
+		return member.GetContactByPhoneNumber(ctx, phoneNumber)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var contacts = make(map[string]*datadip.Contact, len(found))
+	for name, v := range found {
+		contacts[name] = v.(*datadip.Contact)
+	}
+	return s.mergeContacts(contacts), nil
+}
+
+// GetMostRecentOpenCaseByContactID looks up a case in every member and merges what they found.
+func (s *compositeStore) GetMostRecentOpenCaseByContactID(ctx context.Context, contactID string) (*datadip.Case, error) {
+	var found, err = s.fanOut(ctx, func(ctx context.Context, member datadip.CaseStore) (interface{}, error) {
+		return member.GetMostRecentOpenCaseByContactID(ctx, contactID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var cases = make(map[string]*datadip.Case, len(found))
+	for name, v := range found {
+		cases[name] = v.(*datadip.Case)
+	}
+	return s.mergeCases(cases), nil
+}
+
+// fanOut calls lookup against every member in parallel and returns the records found by member name. If no member
+// found a record, it returns the error of the first member that failed, ErrNotFound if every member answered that it
+// found nothing, or a deadline error if some members did not answer in time.
+func (s *compositeStore) fanOut(ctx context.Context, lookup func(context.Context, datadip.CaseStore) (interface{}, error)) (map[string]interface{}, error) {
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithCancel(ctx)
+	defer cancel()
+
+	var results = make(chan compositeResult, len(s.members))
+	for _, m := range s.members {
+		go func(m compositeMember) {
+			var v, err = lookup(ctx, m.Store)
+			results <- compositeResult{name: m.Name, val: v, err: err}
+		}(m)
+	}
+
+	// Merge after mergeTimeout, or just before the deadline if that comes first
+	var wait, merge = s.mergeTimeout, s.mergeTimeout > 0
+	if deadline, ok := ctx.Deadline(); ok {
+		if untilDeadline := time.Until(deadline) - compositeMergeMargin; !merge || untilDeadline < wait {
+			wait, merge = untilDeadline, true
+		}
+	}
+	var timeout <-chan time.Time
+	if merge {
+		var timer = time.NewTimer(wait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	// Collect answers until every member has answered or it is time to merge what we have
+	var found = make(map[string]interface{})
+	var errs = make(map[string]error)
+	var answered int
+collect:
+	for answered < len(s.members) {
+		select {
+		case res := <-results:
+			answered++
+			if res.err != nil {
+				errs[res.name] = res.err
+			} else {
+				found[res.name] = res.val
+			}
+		case <-timeout:
+			break collect
+		case <-ctx.Done():
+			break collect
+		}
+	}
+
+	if len(found) > 0 {
+		return found, nil
+	}
+	for _, m := range s.members {
+		if err, ok := errs[m.Name]; ok && err != datadip.ErrNotFound {
+			return nil, err
+		}
+	}
+	if answered == len(s.members) {
+		return nil, datadip.ErrNotFound
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return nil, context.DeadlineExceeded
+}
+
+// ranked returns the names of the members in found, in order of precedence for field.
+func (s *compositeStore) ranked(field string, found func(name string) bool) []string {
+	var names []string
+	var seen = make(map[string]bool)
+	for _, name := range s.precedence[field] {
+		if found(name) && !seen[name] {
+			names = append(names, name)
+			seen[name] = true
+		}
+	}
+	for _, m := range s.members {
+		if found(m.Name) && !seen[m.Name] {
+			names = append(names, m.Name)
+			seen[m.Name] = true
+		}
+	}
+	return names
+}
+
+// mergeAccounts merges the accounts found by each member into one.
+func (s *compositeStore) mergeAccounts(accounts map[string]*datadip.Account) *datadip.Account {
+	var found = func(name string) bool { return accounts[name] != nil }
+	var pick = func(field string, get func(*datadip.Account) string) string {
+		for _, name := range s.ranked(field, found) {
+			if v := get(accounts[name]); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	var merged datadip.Account
+	merged.ID = pick("Id", func(a *datadip.Account) string { return a.ID })
+	merged.Name = pick("Name", func(a *datadip.Account) string { return a.Name })
+	merged.Number = pick("Number", func(a *datadip.Account) string { return a.Number })
+	merged.CustomAttribute = pick("CustomAttribute", func(a *datadip.Account) string { return a.CustomAttribute })
+
+	var emails []datadip.EmailAddress
+	for _, name := range s.ranked("EmailAddresses", found) {
+		if a := accounts[name]; a.EmailAddresses != nil {
+			emails = append(emails, a.EmailAddresses.EmailAddress...)
+		}
+	}
+	merged.EmailAddresses = uniqueEmailAddresses(emails)
+
+	var phones []datadip.PhoneNumber
+	for _, name := range s.ranked("PhoneNumbers", found) {
+		if a := accounts[name]; a.PhoneNumbers != nil {
+			phones = append(phones, a.PhoneNumbers.PhoneNumbers...)
+		}
+	}
+	merged.PhoneNumbers = uniquePhoneNumbers(phones)
+
+	var addresses []datadip.Address
+	for _, name := range s.ranked("Addresses", found) {
+		if a := accounts[name]; a.Addresses != nil {
+			addresses = append(addresses, a.Addresses.Address...)
+		}
+	}
+	merged.Addresses = uniqueAddresses(addresses)
+
+	return &merged
+}
+
+// mergeContacts merges the contacts found by each member into one.
+func (s *compositeStore) mergeContacts(contacts map[string]*datadip.Contact) *datadip.Contact {
+	var found = func(name string) bool { return contacts[name] != nil }
+	var pick = func(field string, get func(*datadip.Contact) string) string {
+		for _, name := range s.ranked(field, found) {
+			if v := get(contacts[name]); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	var merged datadip.Contact
+	merged.ID = pick("Id", func(c *datadip.Contact) string { return c.ID })
+	merged.FirstName = pick("FirstName", func(c *datadip.Contact) string { return c.FirstName })
+	merged.LastName = pick("LastName", func(c *datadip.Contact) string { return c.LastName })
+	merged.FullName = pick("FullName", func(c *datadip.Contact) string { return c.FullName })
+	merged.CustomAttribute = pick("CustomAttribute", func(c *datadip.Contact) string { return c.CustomAttribute })
+
+	for _, name := range s.ranked("Address", found) {
+		if c := contacts[name]; c.Address != nil {
+			merged.Address = c.Address
+			break
+		}
+	}
+
+	var emails []datadip.EmailAddress
+	for _, name := range s.ranked("EmailAddresses", found) {
+		if c := contacts[name]; c.EmailAddresses != nil {
+			emails = append(emails, c.EmailAddresses.EmailAddress...)
+		}
+	}
+	merged.EmailAddresses = uniqueEmailAddresses(emails)
+
+	var phones []datadip.PhoneNumber
+	for _, name := range s.ranked("PhoneNumbers", found) {
+		if c := contacts[name]; c.PhoneNumbers != nil {
+			phones = append(phones, c.PhoneNumbers.PhoneNumbers...)
+		}
+	}
+	merged.PhoneNumbers = uniquePhoneNumbers(phones)
+
+	return &merged
+}
+
+// mergeCases merges the cases found by each member that have the same Id as the most trusted one's into one.
+func (s *compositeStore) mergeCases(cases map[string]*datadip.Case) *datadip.Case {
+	var id string
+	if names := s.ranked("Id", func(name string) bool { return cases[name] != nil }); len(names) > 0 {
+		id = cases[names[0]].ID
+	}
+	var found = func(name string) bool { return cases[name] != nil && cases[name].ID == id }
+	var pick = func(field string, get func(*datadip.Case) string) string {
+		for _, name := range s.ranked(field, found) {
+			if v := get(cases[name]); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	var merged datadip.Case
+	merged.ID = id
+	merged.Number = pick("Number", func(c *datadip.Case) string { return c.Number })
+	merged.Subject = pick("Subject", func(c *datadip.Case) string { return c.Subject })
+	merged.Description = pick("Description", func(c *datadip.Case) string { return c.Description })
+	merged.Status = pick("Status", func(c *datadip.Case) string { return c.Status })
+	merged.Priority = pick("Priority", func(c *datadip.Case) string { return c.Priority })
+	merged.CreatedDate = pick("CreatedDate", func(c *datadip.Case) string { return c.CreatedDate })
+	merged.ContactID = pick("ContactId", func(c *datadip.Case) string { return c.ContactID })
+	merged.CustomAttribute = pick("CustomAttribute", func(c *datadip.Case) string { return c.CustomAttribute })
+
+	return &merged
+}
+
+// uniqueEmailAddresses drops repeated email addresses, ignoring case, keeping the first of each. It returns nil if
+// there are none.
+func uniqueEmailAddresses(emails []datadip.EmailAddress) *datadip.EmailAddresses {
+	var unique []datadip.EmailAddress
+	var seen = make(map[string]bool)
+	for _, e := range emails {
+		var key = strings.ToLower(strings.TrimSpace(e.EmailAddress))
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, e)
+		}
+	}
+	if len(unique) == 0 {
+		return nil
+	}
+	return &datadip.EmailAddresses{EmailAddress: unique}
+}
+
+// uniquePhoneNumbers drops repeated phone numbers, ignoring formatting, keeping the first of each. It returns nil if
+// there are none.
+func uniquePhoneNumbers(phones []datadip.PhoneNumber) *datadip.PhoneNumbers {
+	var unique []datadip.PhoneNumber
+	var seen = make(map[string]bool)
+	for _, p := range phones {
+		var key = normalizePhoneNumber(p.Number)
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, p)
+		}
+	}
+	if len(unique) == 0 {
+		return nil
+	}
+	return &datadip.PhoneNumbers{PhoneNumbers: unique}
+}
+
+// uniqueAddresses drops repeated addresses, ignoring case and surrounding spaces, keeping the first of each. It
+// returns nil if there are none.
+func uniqueAddresses(addresses []datadip.Address) *datadip.Addresses {
+	var unique []datadip.Address
+	var seen = make(map[string]bool)
+	for _, a := range addresses {
+		var parts = []string{a.Line1, a.Line2, a.Line3, a.City, a.State, a.PostalCode, a.Country, a.Type}
+		for i := range parts {
+			parts[i] = strings.ToLower(strings.TrimSpace(parts[i]))
+		}
+		var key = strings.Join(parts, "\x00")
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, a)
+		}
+	}
+	if len(unique) == 0 {
+		return nil
+	}
+	return &datadip.Addresses{Address: unique}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"purecloudwebservice/datadip"
+	"purecloudwebservice/datadip/datadiptest"
+)
+
+func TestCompositeStore(t *testing.T) {
+	var crm = &datadiptest.Store{Accounts: map[string]*datadip.Account{
+		"123": {ID: "crm-1", Name: "Ng Sze Min", Number: "123",
+			EmailAddresses: &datadip.EmailAddresses{EmailAddress: []datadip.EmailAddress{{EmailAddress: "szemin@crm.example", EmailType: 1}}},
+			PhoneNumbers:   &datadip.PhoneNumbers{PhoneNumbers: []datadip.PhoneNumber{{Number: "+60 3-2776 3333", PhoneType: 1}}}},
+	}}
+	var marketing = &datadiptest.Store{Accounts: map[string]*datadip.Account{
+		"123": {ID: "mkt-1", Name: "Sze Min Ng", CustomAttribute: "gold",
+			EmailAddresses: &datadip.EmailAddresses{EmailAddress: []datadip.EmailAddress{{EmailAddress: "szemin@mkt.example", EmailType: 2}, {EmailAddress: "SZEMIN@crm.example", EmailType: 2}}},
+			PhoneNumbers:   &datadip.PhoneNumbers{PhoneNumbers: []datadip.PhoneNumber{{Number: "+60327763333", PhoneType: 2}}}},
+	}}
+	var members = []compositeMember{{Name: "crm", Store: crm}, {Name: "marketing", Store: marketing}}
+
+	var tests = []struct {
+		name       string
+		precedence map[string][]string
+		id         string
+		fullName   string
+		emails     []string
+	}{
+		{"members in the order given", nil, "crm-1", "Ng Sze Min", []string{"szemin@crm.example", "szemin@mkt.example"}},
+		{"fields with precedence", map[string][]string{"Name": {"marketing"}, "EmailAddresses": {"marketing", "crm"}},
+			"crm-1", "Sze Min Ng", []string{"szemin@mkt.example", "SZEMIN@crm.example"}},
+	}
+	for _, tt := range tests {
+		var s = newCompositeStore(members, tt.precedence, 0)
+		var a, err = s.GetAccountByAccountNumber(context.Background(), "123")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if a.ID != tt.id || a.Name != tt.fullName || a.Number != "123" || a.CustomAttribute != "gold" {
+			t.Errorf("%s: account = %+v", tt.name, a)
+		}
+		var emails []string
+		for _, e := range a.EmailAddresses.EmailAddress {
+			emails = append(emails, e.EmailAddress)
+		}
+		if len(emails) != len(tt.emails) || emails[0] != tt.emails[0] || emails[1] != tt.emails[1] {
+			t.Errorf("%s: email addresses = %v, want %v", tt.name, emails, tt.emails)
+		}
+		// Phone numbers are the same number formatted differently
+		if n := len(a.PhoneNumbers.PhoneNumbers); n != 1 {
+			t.Errorf("%s: %d phone numbers, want 1", tt.name, n)
+		}
+	}
+}
+
+func TestCompositeStoreCases(t *testing.T) {
+	var crm = &datadiptest.Store{Cases: map[string]*datadip.Case{"2": {ID: "5", Subject: "Billing enquiry", Status: "New"}}}
+	var ticketing = &datadiptest.Store{Cases: map[string]*datadip.Case{"2": {ID: "5", Status: "Escalated", Priority: "High"}}}
+	var other = &datadiptest.Store{Cases: map[string]*datadip.Case{"2": {ID: "9", Subject: "Address change", Description: "Moved house"}}}
+	var members = []compositeMember{{"crm", crm}, {"other", other}, {"ticketing", ticketing}}
+
+	var tests = []struct {
+		name       string
+		precedence map[string][]string
+		want       datadip.Case
+	}{
+		// Fields of another case are never mixed in
+		{"members in the order given", nil, datadip.Case{ID: "5", Subject: "Billing enquiry", Status: "New", Priority: "High"}},
+		{"fields with precedence", map[string][]string{"Status": {"ticketing"}}, datadip.Case{ID: "5", Subject: "Billing enquiry", Status: "Escalated", Priority: "High"}},
+		{"case with precedence", map[string][]string{"Id": {"other"}}, datadip.Case{ID: "9", Subject: "Address change", Description: "Moved house"}},
+	}
+	for _, tt := range tests {
+		var s = newCompositeStore(members, tt.precedence, 0)
+		if c, err := s.GetMostRecentOpenCaseByContactID(context.Background(), "2"); err != nil || *c != tt.want {
+			t.Errorf("%s: case = %+v, %v; want %+v", tt.name, c, err, tt.want)
+		}
+	}
+
+	// Every case field can be given precedence in the configuration
+	var cfg = &config{Backend: "cases", Backends: []backendConfig{
+		{Name: "crm", Type: backendSample},
+		{Name: "ticketing", Type: backendSample},
+		{Name: "cases", Type: backendComposite, Members: []string{"crm", "ticketing"}, Fields: map[string][]string{}},
+	}}
+	for _, field := range []string{"Id", "Number", "Subject", "Description", "Status", "Priority", "CreatedDate", "ContactId", "CustomAttribute"} {
+		cfg.Backends[2].Fields[field] = []string{"ticketing"}
+	}
+	if problems := cfg.validate(); len(problems) > 0 {
+		t.Errorf("problems with case fields = %q", problems)
+	}
+}
+
+func TestCompositeStoreMissingMembers(t *testing.T) {
+	var crmDown = errors.New("crm down")
+	var found = datadiptest.NewStore()
+	var slow = datadiptest.NewStore()
+	slow.Accounts["123"] = &datadip.Account{Name: "Slow"}
+	slow.Delay = time.Second
+	var failing = &datadiptest.Store{Err: crmDown}
+	var empty = &datadiptest.Store{}
+
+	var tests = []struct {
+		name    string
+		members []compositeMember
+		timeout time.Duration
+		key     string
+		want    string
+		err     error
+	}{
+		{"slow member left out after the merge timeout", []compositeMember{{"slow", slow}, {"found", found}}, 20 * time.Millisecond, "123", "Ng Sze Min", nil},
+		{"failed member left out", []compositeMember{{"failing", failing}, {"found", found}}, 0, "123", "Ng Sze Min", nil},
+		{"nobody has it", []compositeMember{{"empty", empty}, {"found", found}}, 0, "999", "", datadip.ErrNotFound},
+		{"failure with nothing found", []compositeMember{{"empty", empty}, {"failing", failing}}, 0, "123", "", crmDown},
+		{"nobody answers in time", []compositeMember{{"slow", slow}}, 20 * time.Millisecond, "123", "", context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		var s = newCompositeStore(tt.members, nil, tt.timeout)
+		var start = time.Now()
+		var a, err = s.GetAccountByAccountNumber(context.Background(), tt.key)
+		if err != tt.err {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if time.Since(start) > 500*time.Millisecond {
+			t.Errorf("%s: took %s", tt.name, time.Since(start))
+		}
+		if err == nil && a.Name != tt.want {
+			t.Errorf("%s: name = %q, want %q", tt.name, a.Name, tt.want)
+		}
+	}
+}
+
+func TestCompositeDeadline(t *testing.T) {
+	var cfg = &config{
+		Backend: "merged",
+		Backends: []backendConfig{
+			{Name: "crm", Type: backendSample},
+			{Name: "marketing", Type: backendSample},
+			{Name: "merged", Type: backendComposite, Members: []string{"crm", "marketing"}},
+		},
+		Actions: map[string]actionConfig{"GetAccountByAccountNumber": {Timeout: duration(100 * time.Millisecond)}},
+	}
+	cfg.applyDefaults()
+	if problems := cfg.validate(); len(problems) > 0 {
+		t.Fatal(problems)
+	}
+	var d, err = newDataDip(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Marketing does not answer before the action deadline
+	var slow = datadiptest.NewStore()
+	slow.Delay = time.Second
+	d.backends["merged"].(*compositeStore).members[1].Store = slow
+	var h = newRouter(cfg, d)
+
+	// Lookups, coalesced as every route's are, are answered with what the members that did answer found
+	for i := 0; i < 5; i++ {
+		if rec := datadiptest.Do(h, "POST", "/GetAccountByAccountNumber", `{"AccountNumber":"123"}`); rec.Code != http.StatusOK {
+			t.Fatalf("lookup %d: status = %d, body %q", i, rec.Code, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,719 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"purecloudwebservice/datadip"
+)
+
+// configEnv names the environment variable holding the configuration file path when -config is not given
+const configEnv = "DATADIP_CONFIG"
+
+// config is the service configuration, read from a JSON file. Every setting is optional: without a file the service
+// listens on PORT, or 8080, and answers every action from the sample backend.
+type config struct {
+	Listen   string                  `json:"listen,omitempty"`
+	TLS      *tlsConfig              `json:"tls,omitempty"`
+	Auth     *authConfig             `json:"auth,omitempty"`
+	Backend  string                  `json:"backend,omitempty"`
+	Backends []backendConfig         `json:"backends,omitempty"`
+	Actions  map[string]actionConfig `json:"actions,omitempty"`
+	Admin    *adminConfig            `json:"admin,omitempty"`
+	Audit    *auditConfig            `json:"audit,omitempty"`
+	Record   *recordConfig           `json:"record,omitempty"`
+	Batch    *batchConfig            `json:"batch,omitempty"`
+	Rules    []ruleConfig            `json:"rules,omitempty"`
+}
+
+// tlsConfig names the certificate and key files to serve HTTPS with
+type tlsConfig struct {
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+}
+
+// authConfig lists the users allowed to call the actions with HTTP Basic authentication. PureCloud sends the
+// credentials configured on the Web Services Data Dip Connector.
+type authConfig struct {
+	Users []userConfig `json:"users"`
+}
+
+type userConfig struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// adminConfig enables the admin API and console, which edit the accounts, contacts and cases of a file backend and
+// show the latest lookups. Its users are separate from the connector's. It is served under /admin, on its own Listen
+// address if one is set or else alongside the actions. Backend defaults to the top level backend and RecentLookups,
+// how many lookups the console shows, to 100.
+type adminConfig struct {
+	Listen        string       `json:"listen,omitempty"`
+	Backend       string       `json:"backend,omitempty"`
+	Users         []userConfig `json:"users"`
+	RecentLookups int          `json:"recentLookups,omitempty"`
+}
+
+// auditConfig enables the audit log, which records every lookup in File, a JSON Lines file that is only ever appended
+// to. Each entry holds the hash of the one before it, so that changes to the file can be detected with verify-audit.
+type auditConfig struct {
+	File string `json:"file"`
+}
+
+// recordConfig enables the traffic recorder, which appends every request the actions answer, with its reply, to File as
+// JSON Lines, for the replay command to send again.
+type recordConfig struct {
+	File string `json:"file"`
+}
+
+// batchConfig limits batch lookups: Concurrency is how many of a batch's lookups run at once, 8 by default, and MaxKeys
+// how many keys a batch may hold, 10000 by default.
+type batchConfig struct {
+	Concurrency int `json:"concurrency,omitempty"`
+	MaxKeys     int `json:"maxKeys,omitempty"`
+}
+
+// Backend types
+const (
+	backendSample    = "sample"
+	backendFile      = "file"
+	backendComposite = "composite"
+	backendFailover  = "failover"
+	backendShadow    = "shadow"
+)
+
+// backendConfig describes one named backend. Sample and file backends talk to data directly and can set their own
+// retry, circuit breaker and bulkhead settings. Composite, failover and shadow backends combine other backends by name.
+type backendConfig struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+
+	// File backends. FieldMappings names the fields of records in File that are not named as in the responses
+	File          string        `json:"file,omitempty"`
+	FieldMappings fieldMappings `json:"fieldMappings,omitempty"`
+
+	// Composite backends. Fields maps response fields to the members that may supply them, most trusted first
+	Members      []string            `json:"members,omitempty"`
+	Fields       map[string][]string `json:"fields,omitempty"`
+	MergeTimeout duration            `json:"mergeTimeout,omitempty"`
+
+	// Failover backends
+	Primary        string   `json:"primary,omitempty"`
+	Secondary      string   `json:"secondary,omitempty"`
+	PrimaryTimeout duration `json:"primaryTimeout,omitempty"`
+	HedgeDelay     duration `json:"hedgeDelay,omitempty"`
+
+	// Shadow backends answer from Primary and compare Shadow with it
+	Shadow        string   `json:"shadow,omitempty"`
+	ShadowTimeout duration `json:"shadowTimeout,omitempty"`
+
+	Retry    *retryConfig    `json:"retry,omitempty"`
+	Breaker  *breakerConfig  `json:"breaker,omitempty"`
+	Bulkhead *bulkheadConfig `json:"bulkhead,omitempty"`
+}
+
+type retryConfig struct {
+	Attempts  int      `json:"attempts"`
+	BaseDelay duration `json:"baseDelay,omitempty"`
+	MaxDelay  duration `json:"maxDelay,omitempty"`
+}
+
+type breakerConfig struct {
+	FailureThreshold int      `json:"failureThreshold"`
+	OpenTimeout      duration `json:"openTimeout"`
+}
+
+type bulkheadConfig struct {
+	MaxConcurrent int `json:"maxConcurrent"`
+	MaxQueue      int `json:"maxQueue"`
+}
+
+// actionConfig holds the settings for one action. Backend defaults to the top level backend and Timeout to
+// datadip.DefaultTimeout.
+type actionConfig struct {
+	Backend    string            `json:"backend,omitempty"`
+	Timeout    duration          `json:"timeout,omitempty"`
+	Cache      *cacheConfig      `json:"cache,omitempty"`
+	Validation *validationConfig `json:"validation,omitempty"`
+
+	// CustomAttribute is a text/template computing the CustomAttribute of the action's responses, e.g.
+	// "{{.Rules}};lang={{default \"en\" .CustomAttribute}}". See customAttributeData.
+	CustomAttribute string `json:"customAttribute,omitempty"`
+}
+
+// validationConfig tightens how an action checks its requests, beyond requiring its key field. Fields holds format
+// rules by request field name, e.g. "AccountNumber". See datadip.Validation.
+type validationConfig struct {
+	MaxBodySize           int64                      `json:"maxBodySize,omitempty"`
+	RequireJSON           bool                       `json:"requireJSON,omitempty"`
+	DisallowUnknownFields bool                       `json:"disallowUnknownFields,omitempty"`
+	Fields                map[string]fieldRuleConfig `json:"fields,omitempty"`
+}
+
+// fieldRuleConfig is the format a request field must have: a regular expression Pattern matching the whole value,
+// and its length in characters.
+type fieldRuleConfig struct {
+	Pattern   string `json:"pattern,omitempty"`
+	MinLength int    `json:"minLength,omitempty"`
+	MaxLength int    `json:"maxLength,omitempty"`
+}
+
+// pattern compiles the rule's Pattern anchored so that it must match the whole value, or returns nil if there is none.
+// A pattern that only compiles on its own, e.g. \Qabc, fails once anchored.
+func (f fieldRuleConfig) pattern() (*regexp.Regexp, error) {
+	if f.Pattern == "" {
+		return nil, nil
+	}
+	if _, err := regexp.Compile(f.Pattern); err != nil {
+		return nil, err
+	}
+	return regexp.Compile("^(?:" + f.Pattern + ")$")
+}
+
+// validation returns the datadip.Validation v describes, or the default one if v is nil. Patterns are anchored so that
+// they must match the whole value.
+func (v *validationConfig) validation() (datadip.Validation, error) {
+	if v == nil {
+		return datadip.Validation{}, nil
+	}
+	var dv = datadip.Validation{MaxBodySize: v.MaxBodySize, RequireJSON: v.RequireJSON, DisallowUnknownFields: v.DisallowUnknownFields}
+	if len(v.Fields) > 0 {
+		dv.Fields = make(map[string]datadip.FieldRule)
+		for name, f := range v.Fields {
+			var rule = datadip.FieldRule{MinLength: f.MinLength, MaxLength: f.MaxLength}
+			var err error
+			if rule.Pattern, err = f.pattern(); err != nil {
+				return dv, fmt.Errorf("fields.%s.pattern: %s", name, err)
+			}
+			dv.Fields[name] = rule
+		}
+	}
+	return dv, nil
+}
+
+// cacheConfig caches lookup results, including records not found, for TTL. MaxEntries of 0 means no limit.
+type cacheConfig struct {
+	TTL        duration `json:"ttl"`
+	MaxEntries int      `json:"maxEntries,omitempty"`
+}
+
+// duration is a time.Duration written in JSON as a string such as "250ms" or "5s"
+type duration time.Duration
+
+func (d duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"500ms\": %s", b)
+	}
+	var v, err = time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// validationError lists every problem found in a configuration
+type validationError []string
+
+func (e validationError) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e, "\n  ")
+}
+
+// configPath returns the configuration file path given by flag, or else by the DATADIP_CONFIG environment variable.
+// It is empty if neither is set.
+func configPath(flag string) string {
+	if flag != "" {
+		return flag
+	}
+	return os.Getenv(configEnv)
+}
+
+// loadConfig reads the configuration file at path, applies environment variable overrides and defaults, and
+// validates the result. An empty path gives the default configuration. Unknown fields in the file are an error. If
+// the configuration is invalid, the error is a validationError listing every problem.
+func loadConfig(path string) (*config, error) {
+	var err error
+
+	var cfg = new(config)
+	if path != "" {
+		var b []byte
+		if b, err = ioutil.ReadFile(path); err != nil {
+			return nil, err
+		}
+		var dec = json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		if err = dec.Decode(cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %s", path, err)
+		}
+	}
+
+	cfg.applyEnv()
+	cfg.applyDefaults()
+	if problems := cfg.validate(); len(problems) > 0 {
+		return nil, problems
+	}
+	return cfg, nil
+}
+
+// applyEnv overrides file settings with environment variables. PORT is honoured for platforms such as Heroku that
+// set it, but DATADIP_LISTEN wins if both are set.
+func (c *config) applyEnv() {
+	if v := os.Getenv("PORT"); v != "" {
+		c.Listen = ":" + v
+	}
+	if v := os.Getenv("DATADIP_LISTEN"); v != "" {
+		c.Listen = v
+	}
+	if v := os.Getenv("DATADIP_BACKEND"); v != "" {
+		c.Backend = v
+	}
+	if cert, key := os.Getenv("DATADIP_TLS_CERT_FILE"), os.Getenv("DATADIP_TLS_KEY_FILE"); cert != "" || key != "" {
+		c.TLS = &tlsConfig{CertFile: cert, KeyFile: key}
+	}
+	if user, pass := os.Getenv("DATADIP_AUTH_USERNAME"), os.Getenv("DATADIP_AUTH_PASSWORD"); user != "" || pass != "" {
+		c.Auth = &authConfig{Users: []userConfig{{Username: user, Password: pass}}}
+	}
+}
+
+// applyDefaults fills in settings left out of the configuration.
+func (c *config) applyDefaults() {
+	if c.Listen == "" {
+		c.Listen = ":8080"
+	}
+	if len(c.Backends) == 0 {
+		c.Backends = []backendConfig{{Name: backendSample, Type: backendSample}}
+	}
+	if c.Backend == "" && len(c.Backends) == 1 {
+		c.Backend = c.Backends[0].Name
+	}
+	if c.Admin != nil && c.Admin.Backend == "" {
+		c.Admin.Backend = c.Backend
+	}
+	if c.Admin != nil && c.Admin.RecentLookups == 0 {
+		c.Admin.RecentLookups = defaultRecentLookups
+	}
+}
+
+// validate returns every problem found in the configuration.
+func (c *config) validate() validationError {
+	var problems validationError
+	var addf = func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.TLS != nil {
+		if c.TLS.CertFile == "" || c.TLS.KeyFile == "" {
+			addf("tls: certFile and keyFile are both required")
+		}
+		for _, f := range []string{c.TLS.CertFile, c.TLS.KeyFile} {
+			if _, err := os.Stat(f); f != "" && err != nil {
+				addf("tls: %s", err)
+			}
+		}
+	}
+
+	if c.Auth != nil {
+		problems = append(problems, validateUsers("auth", c.Auth.Users)...)
+	}
+
+	// Backends first, so that references to them can be checked
+	var backends = make(map[string]backendConfig)
+	for i, b := range c.Backends {
+		if b.Name == "" {
+			addf("backends[%d]: name is required", i)
+			continue
+		}
+		if _, ok := backends[b.Name]; ok {
+			addf("backends[%d]: duplicate backend name %q", i, b.Name)
+			continue
+		}
+		backends[b.Name] = b
+	}
+	for _, b := range c.Backends {
+		if b.Name != "" {
+			problems = append(problems, b.validate(backends)...)
+		}
+	}
+	for _, name := range sortedBackendNames(backends) {
+		if cycle := findBackendCycle(name, backends, nil); cycle != nil && cycle[0] == name {
+			addf("backend %q: refers to itself through %s", name, strings.Join(cycle, " -> "))
+		}
+	}
+
+	if c.Backend == "" {
+		addf("backend: the default backend is required when there is more than one backend")
+	} else if _, ok := backends[c.Backend]; !ok {
+		addf("backend: unknown backend %q", c.Backend)
+	}
+
+	var names = make([]string, 0, len(c.Actions))
+	for name := range c.Actions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var a = c.Actions[name]
+		var info, known = datadip.FindAction(name)
+		if !known {
+			addf("actions.%s: unknown action", name)
+			continue
+		}
+		if !info.Implemented {
+			addf("actions.%s: action is not implemented", name)
+			continue
+		}
+		if _, ok := backends[a.Backend]; a.Backend != "" && !ok {
+			addf("actions.%s: unknown backend %q", name, a.Backend)
+		}
+		if a.Timeout < 0 {
+			addf("actions.%s: timeout must not be negative", name)
+		}
+		if a.Cache != nil {
+			if a.Cache.TTL <= 0 {
+				addf("actions.%s: cache.ttl must be positive", name)
+			}
+			if a.Cache.MaxEntries < 0 {
+				addf("actions.%s: cache.maxEntries must not be negative", name)
+			}
+		}
+		if a.CustomAttribute != "" {
+			if _, err := parseCustomAttribute(info, a.CustomAttribute); err != nil {
+				addf("actions.%s: customAttribute: %s", name, err)
+			}
+		}
+		if a.Validation != nil {
+			if a.Validation.MaxBodySize < 0 {
+				addf("actions.%s: validation.maxBodySize must not be negative", name)
+			}
+			var fields = make(map[string]bool)
+			for _, f := range info.RequestFields() {
+				fields[f] = true
+			}
+			var fieldNames []string
+			for f := range a.Validation.Fields {
+				fieldNames = append(fieldNames, f)
+			}
+			sort.Strings(fieldNames)
+			for _, f := range fieldNames {
+				var rule = a.Validation.Fields[f]
+				if !fields[f] {
+					addf("actions.%s: validation.fields: %q is not a field of the request", name, f)
+				}
+				if _, err := rule.pattern(); err != nil {
+					addf("actions.%s: validation.fields.%s.pattern: %s", name, f, err)
+				}
+				if rule.MinLength < 0 || rule.MaxLength < 0 || (rule.MaxLength > 0 && rule.MinLength > rule.MaxLength) {
+					addf("actions.%s: validation.fields.%s: minLength and maxLength must not be negative, and minLength at most maxLength", name, f)
+				}
+			}
+		}
+	}
+
+	if c.Admin != nil {
+		problems = append(problems, validateUsers("admin", c.Admin.Users)...)
+		if b, ok := backends[c.Admin.Backend]; !ok {
+			addf("admin.backend: unknown backend %q", c.Admin.Backend)
+		} else if b.Type != backendFile {
+			addf("admin.backend: %q is not a file backend", c.Admin.Backend)
+		}
+		if c.Admin.RecentLookups < 0 {
+			addf("admin.recentLookups must not be negative")
+		}
+		if c.Admin.Listen != "" && c.Admin.Listen == c.Listen {
+			addf("admin.listen: must differ from listen, or be left out to serve the admin API alongside the actions")
+		}
+	}
+
+	if c.Audit != nil && c.Audit.File == "" {
+		addf("audit.file is required")
+	}
+	if c.Record != nil && c.Record.File == "" {
+		addf("record.file is required")
+	}
+	if c.Audit != nil && c.Record != nil && c.Audit.File == c.Record.File {
+		addf("record.file: must differ from audit.file")
+	}
+	if c.Batch != nil && (c.Batch.Concurrency < 0 || c.Batch.MaxKeys < 0) {
+		addf("batch: concurrency and maxKeys must not be negative")
+	}
+
+	for i, r := range c.Rules {
+		if len(r.Set) == 0 {
+			addf("rules[%d]: set is required", i)
+		}
+		for name, value := range r.Set {
+			if name == "" || strings.ContainsAny(name, "=;") || strings.Contains(value, ";") {
+				addf("rules[%d].set: attribute names must not be empty or hold = or ;, and values must not hold ;", i)
+				break
+			}
+		}
+		for _, name := range r.Actions {
+			if info, known := datadip.FindAction(name); !known || !info.Implemented {
+				addf("rules[%d].actions: %q is not an implemented action", i, name)
+			}
+		}
+		for j, cc := range r.When {
+			if _, err := newCondition(cc); err != nil {
+				addf("rules[%d].when[%d]: %s", i, j, err)
+			}
+		}
+	}
+
+	return problems
+}
+
+// validateUsers returns every problem found in the users of the setting called name.
+func validateUsers(name string, users []userConfig) []string {
+	var problems []string
+	if len(users) == 0 {
+		problems = append(problems, fmt.Sprintf("%s: at least one user is required", name))
+	}
+	var seen = make(map[string]bool)
+	for i, u := range users {
+		if u.Username == "" || u.Password == "" {
+			problems = append(problems, fmt.Sprintf("%s.users[%d]: username and password are both required", name, i))
+		}
+		if seen[u.Username] {
+			problems = append(problems, fmt.Sprintf("%s.users[%d]: duplicate username %q", name, i, u.Username))
+		}
+		seen[u.Username] = true
+	}
+	return problems
+}
+
+// validate returns every problem found in one backend's settings. backends holds every backend by name.
+func (b backendConfig) validate(backends map[string]backendConfig) []string {
+	var problems []string
+	var addf = func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf("backend %q: ", b.Name)+fmt.Sprintf(format, args...))
+	}
+	var checkRef = func(field, name string) {
+		if name == "" {
+			addf("%s is required", field)
+		} else if _, ok := backends[name]; !ok {
+			addf("%s: unknown backend %q", field, name)
+		}
+	}
+
+	switch b.Type {
+	case backendSample:
+	case backendFile:
+		if b.File == "" {
+			addf("file is required")
+		} else if _, err := os.Stat(b.File); err != nil {
+			addf("%s", err)
+		}
+		problems = append(problems, b.FieldMappings.validate(b.Name)...)
+	case backendComposite:
+		if len(b.Members) == 0 {
+			addf("members is required")
+		}
+		var members = make(map[string]bool)
+		for _, m := range b.Members {
+			checkRef("members", m)
+			members[m] = true
+		}
+		for field, names := range b.Fields {
+			if !responseFields[field] {
+				addf("fields: unknown field %q", field)
+			}
+			for _, name := range names {
+				if !members[name] {
+					addf("fields.%s: %q is not a member", field, name)
+				}
+			}
+		}
+		if b.MergeTimeout < 0 {
+			addf("mergeTimeout must not be negative")
+		}
+	case backendFailover:
+		checkRef("primary", b.Primary)
+		checkRef("secondary", b.Secondary)
+		if b.PrimaryTimeout < 0 || b.HedgeDelay < 0 {
+			addf("primaryTimeout and hedgeDelay must not be negative")
+		}
+	case backendShadow:
+		checkRef("primary", b.Primary)
+		checkRef("shadow", b.Shadow)
+		if b.ShadowTimeout < 0 {
+			addf("shadowTimeout must not be negative")
+		}
+	case "":
+		addf("type is required")
+	default:
+		addf("unknown type %q", b.Type)
+	}
+
+	if b.Type != backendFile && b.FieldMappings != nil {
+		addf("fieldMappings is only for file backends")
+	}
+	if (b.Type == backendComposite || b.Type == backendFailover || b.Type == backendShadow) && (b.Retry != nil || b.Breaker != nil || b.Bulkhead != nil) {
+		addf("retry, breaker and bulkhead belong on the backends it combines")
+	}
+	if b.Retry != nil && (b.Retry.Attempts < 1 || b.Retry.BaseDelay < 0 || b.Retry.MaxDelay < b.Retry.BaseDelay) {
+		addf("retry: attempts must be at least 1 and 0 <= baseDelay <= maxDelay")
+	}
+	if b.Breaker != nil && (b.Breaker.FailureThreshold < 1 || b.Breaker.OpenTimeout <= 0) {
+		addf("breaker: failureThreshold must be at least 1 and openTimeout positive")
+	}
+	if b.Bulkhead != nil && (b.Bulkhead.MaxConcurrent < 1 || b.Bulkhead.MaxQueue < 0) {
+		addf("bulkhead: maxConcurrent must be at least 1 and maxQueue not negative")
+	}
+	return problems
+}
+
+// validate returns every problem found in the field mappings of the file backend named backend.
+func (m fieldMappings) validate(backend string) []string {
+	var problems []string
+	var lists = make([]string, 0, len(m))
+	for list := range m {
+		lists = append(lists, list)
+	}
+	sort.Strings(lists)
+	for _, list := range lists {
+		var t, ok = storeFileRecords[list]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("backend %q: fieldMappings: %q is not Accounts, Contacts or Cases", backend, list))
+			continue
+		}
+		var fields = make(map[string]bool)
+		for i := 0; i < t.NumField(); i++ {
+			fields[strings.Split(t.Field(i).Tag.Get("json"), ",")[0]] = true
+		}
+		var names = make([]string, 0, len(m[list]))
+		for from := range m[list] {
+			names = append(names, from)
+		}
+		sort.Strings(names)
+		var mapped = make(map[string]string)
+		for _, from := range names {
+			var to = m[list][from]
+			switch {
+			case from == "":
+				problems = append(problems, fmt.Sprintf("backend %q: fieldMappings.%s: field names must not be empty", backend, list))
+			case !fields[to]:
+				problems = append(problems, fmt.Sprintf("backend %q: fieldMappings.%s.%s: %q is not a field of %s", backend, list, from, to, t.Name()))
+			case mapped[to] != "":
+				problems = append(problems, fmt.Sprintf("backend %q: fieldMappings.%s: %s and %s both map to %s", backend, list, mapped[to], from, to))
+			default:
+				mapped[to] = from
+			}
+		}
+	}
+	return problems
+}
+
+// references returns the names of the backends a backend combines.
+func (b backendConfig) references() []string {
+	switch b.Type {
+	case backendComposite:
+		return b.Members
+	case backendFailover:
+		return []string{b.Primary, b.Secondary}
+	case backendShadow:
+		return []string{b.Primary, b.Shadow}
+	}
+	return nil
+}
+
+// shadowOnlyBackends returns the names of the backends that only shadow lookups are made against: the shadows of shadow
+// backends, and the backends they combine, that no lookup is answered from otherwise. c must have been validated.
+func (c *config) shadowOnlyBackends() map[string]bool {
+	var configs = make(map[string]backendConfig)
+	for _, b := range c.Backends {
+		configs[b.Name] = b
+	}
+
+	// Follow the actions' backends, and those no other backend combines, except into shadows
+	var answering = make(map[string]bool)
+	var visit func(name string)
+	visit = func(name string) {
+		if answering[name] {
+			return
+		}
+		answering[name] = true
+		var b = configs[name]
+		for _, ref := range b.references() {
+			if b.Type != backendShadow || ref != b.Shadow {
+				visit(ref)
+			}
+		}
+	}
+	var referenced = make(map[string]bool)
+	for _, b := range c.Backends {
+		for _, ref := range b.references() {
+			referenced[ref] = true
+		}
+	}
+	visit(c.Backend)
+	for name := range c.Actions {
+		visit(c.actionBackend(name))
+	}
+	for _, b := range c.Backends {
+		if !referenced[b.Name] {
+			visit(b.Name)
+		}
+	}
+
+	var shadowOnly = make(map[string]bool)
+	for _, b := range c.Backends {
+		if !answering[b.Name] {
+			shadowOnly[b.Name] = true
+		}
+	}
+	return shadowOnly
+}
+
+// findBackendCycle returns the chain of backend names leading from name back to a backend already in path, or nil if
+// there is none.
+func findBackendCycle(name string, backends map[string]backendConfig, path []string) []string {
+	for i, p := range path {
+		if p == name {
+			return append(append([]string(nil), path[i:]...), name)
+		}
+	}
+	var b, ok = backends[name]
+	if !ok {
+		return nil
+	}
+	for _, ref := range b.references() {
+		if cycle := findBackendCycle(ref, backends, append(path, name)); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// sortedBackendNames returns the names of backends in order.
+func sortedBackendNames(backends map[string]backendConfig) []string {
+	var names = make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// responseFields holds the Account, Contact and Case fields, as named in JSON, that a composite backend can take from
+// particular members
+var responseFields = map[string]bool{
+	"Id": true, "Name": true, "Number": true, "FirstName": true, "LastName": true, "FullName": true,
+	"EmailAddresses": true, "PhoneNumbers": true, "Addresses": true, "Address": true, "CustomAttribute": true,
+	"Subject": true, "Description": true, "Status": true, "Priority": true, "CreatedDate": true, "ContactId": true,
+}
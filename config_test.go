@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigValidate(t *testing.T) {
+	// One problem of each kind, all of which must be reported together
+	var cfg = &config{
+		Auth:    &authConfig{Users: []userConfig{{Username: "purecloud"}}},
+		Backend: "crm",
+		Backends: []backendConfig{
+			{Name: "sample", Type: backendSample},
+			{Name: "sample", Type: backendSample},
+			{Name: "a", Type: backendFailover, Primary: "b", Secondary: "sample"},
+			{Name: "b", Type: backendComposite, Members: []string{"a", "missing"}},
+			{Name: "untyped"},
+			{Name: "flaky", Type: backendSample, Retry: &retryConfig{Attempts: 0}},
+		},
+		Actions: map[string]actionConfig{
+			"GetAccountByAccountNumber": {Backend: "missing", Cache: &cacheConfig{TTL: duration(-time.Second)}},
+			"GetAccountByContactId":     {},
+			"GetCaseByCaseNumber":       {},
+		},
+		Audit: &auditConfig{},
+	}
+	var want = []string{
+		`auth.users[0]: username and password are both required`,
+		`backends[1]: duplicate backend name "sample"`,
+		`backend "b": members: unknown backend "missing"`,
+		`backend "untyped": type is required`,
+		`backend "flaky": retry: attempts must be at least 1 and 0 <= baseDelay <= maxDelay`,
+		`backend "a": refers to itself through a -> b -> a`,
+		`backend "b": refers to itself through b -> a -> b`,
+		`backend: unknown backend "crm"`,
+		`actions.GetAccountByAccountNumber: unknown backend "missing"`,
+		`actions.GetAccountByAccountNumber: cache.ttl must be positive`,
+		`actions.GetAccountByContactId: action is not implemented`,
+		`actions.GetCaseByCaseNumber: unknown action`,
+		`audit.file is required`,
+	}
+	if got := cfg.validate(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("problems =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+
+	"purecloudwebservice/datadip"
+)
+
+// customAttributeFuncs are the functions a CustomAttribute template may call besides text/template's own
+var customAttributeFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+	// default returns v, or def if v is empty, e.g. {{default "en" .Record.CustomAttribute}}
+	"default": func(def, v string) string {
+		if v == "" {
+			return def
+		}
+		return v
+	},
+}
+
+// customAttributeData is what a CustomAttribute template is executed with. Record is the record looked up, e.g. a
+// *datadip.Account, Request the request, CustomAttribute the request's CustomAttribute and Attributes those set by the
+// rules, e.g. {{.Attributes.tier}}, with Rules the same formatted as the rules alone would set the CustomAttribute.
+type customAttributeData struct {
+	Record          interface{}
+	Request         interface{}
+	CustomAttribute string
+	Attributes      map[string]string
+	Rules           string
+}
+
+// parseCustomAttribute compiles text, the CustomAttribute template of action. Besides syntax errors, it catches
+// fields that neither the action's record nor its request has by trying the template on empty ones.
+func parseCustomAttribute(action datadip.Action, text string) (*template.Template, error) {
+	var tmpl, err = template.New(action.Name).Funcs(customAttributeFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	var req = reflect.New(reflect.TypeOf(action.Request)).Interface()
+	var resp = reflect.New(reflect.TypeOf(action.Response)).Interface()
+	// Other errors, such as indexing an empty list, may well not happen with a real record
+	if _, _, err = customAttribute(tmpl, nil, req, resp); err != nil && strings.Contains(err.Error(), "can't evaluate field") {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// customAttribute computes the CustomAttribute of a lookup with req and resp from attrs, set by the rules, and tmpl,
+// either of which may be empty. Without a template it is attrs formatted, if there are any. ok is false if the
+// CustomAttribute is to be left as the backend returned it.
+func customAttribute(tmpl *template.Template, attrs map[string]string, req, resp interface{}) (value string, ok bool, err error) {
+	if tmpl == nil {
+		return formatAttributes(attrs), len(attrs) > 0, nil
+	}
+	if attrs == nil {
+		attrs = make(map[string]string)
+	}
+	var data = customAttributeData{
+		Record:          responseRecord(resp),
+		Request:         req,
+		CustomAttribute: reflect.ValueOf(req).Elem().FieldByName("CustomAttribute").String(),
+		Attributes:      attrs,
+		Rules:           formatAttributes(attrs),
+	}
+	var b bytes.Buffer
+	if err = tmpl.Execute(&b, data); err != nil {
+		return "", false, err
+	}
+	return b.String(), true, nil
+}
+
+// customAttributeDecorator returns the datadip.Decorator that sets the CustomAttribute of action's responses from rs
+// and tmpl, either of which may be nil. If the template fails, the error is logged and the CustomAttribute the backend
+// returned is kept.
+func customAttributeDecorator(action string, rs *ruleSet, tmpl *template.Template) datadip.Decorator {
+	return func(req, resp interface{}) {
+		var attrs map[string]string
+		if rs != nil {
+			attrs, _ = rs.evaluate(action, req, resp, time.Now())
+		}
+		var value, ok, err = customAttribute(tmpl, attrs, req, resp)
+		if err != nil {
+			log.Printf("Failed to compute the CustomAttribute for %s: %s\n", action, err)
+			return
+		}
+		if ok {
+			setCustomAttribute(resp, value)
+		}
+	}
+}
+
+// responseRecord returns a pointer to the record in resp, a pointer to a response.
+func responseRecord(resp interface{}) interface{} {
+	switch r := resp.(type) {
+	case *datadip.AccountResponse:
+		return &r.Account
+	case *datadip.ContactResponse:
+		return &r.Contact
+	case *datadip.CaseResponse:
+		return &r.Case
+	}
+	return nil
+}
+
+// setCustomAttribute sets the CustomAttribute of the record in resp, a pointer to a response.
+func setCustomAttribute(resp interface{}, value string) {
+	switch r := resp.(type) {
+	case *datadip.AccountResponse:
+		r.Account.CustomAttribute = value
+	case *datadip.ContactResponse:
+		r.Contact.CustomAttribute = value
+	case *datadip.CaseResponse:
+		r.Case.CustomAttribute = value
+	}
+}
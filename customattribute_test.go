@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"purecloudwebservice/datadip"
+	"purecloudwebservice/datadip/datadiptest"
+)
+
+func TestCustomAttribute(t *testing.T) {
+	var cfg = &config{
+		Rules: []ruleConfig{
+			{Name: "vip", When: []conditionConfig{{Field: "Account.Name", Op: "prefix", Value: "Ng "}}, Set: map[string]string{"tier": "gold"}},
+			{Name: "malaysia", When: []conditionConfig{{Field: "Request.PhoneNumber", Op: "prefix", Value: "+60"}}, Set: map[string]string{"language": "ms"}},
+		},
+		Actions: map[string]actionConfig{
+			"GetAccountByAccountNumber":        {CustomAttribute: `tier={{.Attributes.tier}};lang={{default "en" .CustomAttribute}};name={{upper .Record.Name}};was={{.Record.CustomAttribute}}`},
+			"GetMostRecentOpenCaseByContactId": {CustomAttribute: `status={{lower .Record.Status}};priority={{.Record.Priority}}`},
+		},
+	}
+	cfg.applyDefaults()
+	if problems := cfg.validate(); len(problems) > 0 {
+		t.Fatal(problems)
+	}
+	var d, err = newDataDip(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var h = newRouter(cfg, d)
+
+	var tests = []struct {
+		name string
+		path string
+		body string
+		want string
+	}{
+		{"template", "/GetAccountByAccountNumber", `{"AccountNumber":"123","CustomAttribute":"ms"}`, "tier=gold;lang=ms;name=NG SZE MIN;was=Custom data here"},
+		{"template with default", "/GetAccountByAccountNumber", `{"AccountNumber":"123"}`, "tier=gold;lang=en;name=NG SZE MIN;was=Custom data here"},
+		{"case template", "/GetMostRecentOpenCaseByContactId", `{"ContactId":"1234567890"}`, "status=new;priority=Medium"},
+		{"rules alone", "/GetContactByPhoneNumber", `{"PhoneNumber":"+60327763333"}`, "language=ms"},
+	}
+	for _, tt := range tests {
+		var rec = datadiptest.Do(h, "POST", tt.path, tt.body)
+		var resp map[string]map[string]interface{}
+		if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &resp) != nil {
+			t.Fatalf("%s: status = %d, body %q", tt.name, rec.Code, rec.Body.String())
+		}
+		for _, record := range resp {
+			if got := record["CustomAttribute"]; got != tt.want {
+				t.Errorf("%s: CustomAttribute = %q, want %q", tt.name, got, tt.want)
+			}
+		}
+	}
+
+	// A template failing on a record keeps the backend's CustomAttribute
+	var info, _ = datadip.FindAction(datadip.ActionGetAccountByAccountNumber)
+	var tmpl, _ = parseCustomAttribute(info, `{{index .Record.EmailAddresses.EmailAddress 5}}`)
+	var resp = &datadip.AccountResponse{Account: datadip.Account{EmailAddresses: &datadip.EmailAddresses{}, CustomAttribute: "from crm"}}
+	customAttributeDecorator(info.Name, nil, tmpl)(&datadip.AccountByAccountNumberRequest{AccountNumber: "123"}, resp)
+	if resp.Account.CustomAttribute != "from crm" {
+		t.Errorf("failed template: CustomAttribute = %q", resp.Account.CustomAttribute)
+	}
+}
+
+func TestCustomAttributeConfig(t *testing.T) {
+	var cfg = &config{Actions: map[string]actionConfig{
+		"GetAccountByAccountNumber": {CustomAttribute: "{{.Record.Status}}"},
+		"GetContactByPhoneNumber":   {CustomAttribute: "{{.Record.FullName"},
+	}}
+	cfg.applyDefaults()
+	var got = strings.Join(cfg.validate(), "\n")
+	for _, want := range []string{
+		"actions.GetAccountByAccountNumber: customAttribute: template: GetAccountByAccountNumber:1:9: executing \"GetAccountByAccountNumber\" at <.Record.Status>: can't evaluate field Status in type interface {}",
+		"actions.GetContactByPhoneNumber: customAttribute: template: GetContactByPhoneNumber:1: unclosed action",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("problems =\n%s\nwant %s", got, want)
+		}
+	}
+
+	// Templates that may only fail on some records, e.g. by indexing a list, are accepted
+	cfg.Actions = map[string]actionConfig{
+		"GetContactByPhoneNumber": {CustomAttribute: "{{(index .Record.PhoneNumbers.PhoneNumbers 0).Number}}"},
+	}
+	if problems := cfg.validate(); len(problems) > 0 {
+		t.Errorf("problems = %s, want none", problems)
+	}
+}
@@ -0,0 +1,39 @@
+package datadip
+
+// Names of the PureCloud Web Services Data Dip Connector actions. Each is served at "/" + name
+const (
+	ActionGetAccountByAccountNumber        = "GetAccountByAccountNumber"
+	ActionGetAccountByContactID            = "GetAccountByContactId"
+	ActionGetAccountByPhoneNumber          = "GetAccountByPhoneNumber"
+	ActionGetContactByPhoneNumber          = "GetContactByPhoneNumber"
+	ActionGetMostRecentOpenCaseByContactID = "GetMostRecentOpenCaseByContactId"
+)
+
+// Action describes one action: whether Handler implements it, which request field holds the lookup key, and its
+// request and response types. Actions that are not implemented reply 501 Not Implemented.
+type Action struct {
+	Name        string
+	Implemented bool
+	KeyField    string
+	Request     interface{}
+	Response    interface{}
+}
+
+// Actions lists every action
+var Actions = []Action{
+	{Name: ActionGetAccountByAccountNumber, Implemented: true, KeyField: "AccountNumber", Request: AccountByAccountNumberRequest{}, Response: AccountResponse{}},
+	{Name: ActionGetAccountByContactID, KeyField: "ContactId", Request: AccountByContactIDRequest{}, Response: AccountResponse{}},
+	{Name: ActionGetAccountByPhoneNumber, KeyField: "PhoneNumber", Request: AccountByPhoneNumberRequest{}, Response: AccountResponse{}},
+	{Name: ActionGetContactByPhoneNumber, Implemented: true, KeyField: "PhoneNumber", Request: ContactByPhoneNumberRequest{}, Response: ContactResponse{}},
+	{Name: ActionGetMostRecentOpenCaseByContactID, Implemented: true, KeyField: "ContactId", Request: MostRecentOpenCaseByContactIDRequest{}, Response: CaseResponse{}},
+}
+
+// FindAction returns the action called name, reporting whether there is one.
+func FindAction(name string) (Action, bool) {
+	for _, a := range Actions {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return Action{}, false
+}
@@ -0,0 +1,91 @@
+package datadip
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// ArchitectField is a leaf field of a response as Architect sees it with Flatten metadata checked
+type ArchitectField struct {
+	// Path is the field's flattened name without list indexes, e.g. "Account.EmailAddresses.EmailAddress.EmailAddress"
+	Path string
+	// Collection is true for fields inside a list, which Architect gets as a collection with one value per element
+	Collection bool
+	// Kind is the Architect data type, e.g. String or Decimal
+	Kind string
+}
+
+// ArchitectFields returns every leaf field of the type of response, e.g. AccountResponse{}, in order.
+func ArchitectFields(response interface{}) []ArchitectField {
+	var fields []ArchitectField
+	var walk func(path string, t reflect.Type, collection bool)
+	walk = func(path string, t reflect.Type, collection bool) {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Struct:
+			for _, f := range jsonFields(t) {
+				var p = f.name
+				if path != "" {
+					p = path + "." + f.name
+				}
+				walk(p, f.field.Type, collection)
+			}
+		case reflect.Slice, reflect.Array:
+			walk(path, t.Elem(), true)
+		case reflect.Float32, reflect.Float64:
+			fields = append(fields, ArchitectField{Path: path, Collection: collection, Kind: "Decimal"})
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			fields = append(fields, ArchitectField{Path: path, Collection: collection, Kind: "Integer"})
+		case reflect.Bool:
+			fields = append(fields, ArchitectField{Path: path, Collection: collection, Kind: "Boolean"})
+		default:
+			fields = append(fields, ArchitectField{Path: path, Collection: collection, Kind: "String"})
+		}
+	}
+	walk("", reflect.TypeOf(response), false)
+	return fields
+}
+
+// Variable returns the name of the flow variable the field is assigned to, e.g. "Flow.Account_Name".
+func (f ArchitectField) Variable(prefix string) string {
+	return prefix + strings.Replace(f.Path, ".", "_", -1)
+}
+
+// DefaultValue returns the Architect literal used when the field is NOT_SET.
+func (f ArchitectField) DefaultValue() string {
+	switch f.Kind {
+	case "Decimal":
+		return "0.0"
+	case "Integer":
+		return "0"
+	case "Boolean":
+		return "false"
+	}
+	return `""`
+}
+
+// Expression returns an Architect expression that reads the field, or its first value for a collection, falling
+// back to the default value instead of failing the flow when it is NOT_SET.
+func (f ArchitectField) Expression(prefix string) string {
+	var v = f.Variable(prefix)
+	if f.Collection {
+		return fmt.Sprintf("If(Count(%s) >= 1,\n  If(IsSet(%s[0]), %s[0], %s),\n  %s)", v, v, v, f.DefaultValue(), f.DefaultValue())
+	}
+	return fmt.Sprintf("If(IsSet(%s), %s, %s)", v, v, f.DefaultValue())
+}
+
+// WriteExpressions writes a safe Architect expression for every leaf field of the type of response to w, reading
+// flow variables named with prefix.
+func WriteExpressions(w io.Writer, response interface{}, prefix string) {
+	for _, f := range ArchitectFields(response) {
+		var kind = f.Kind
+		if f.Collection {
+			kind += " collection"
+		}
+		fmt.Fprintf(w, "// %s (%s) in %s\n%s\n\n", f.Path, kind, f.Variable(prefix), f.Expression(prefix))
+	}
+}
@@ -0,0 +1,76 @@
+package datadip_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"purecloudwebservice/datadip"
+)
+
+func TestArchitectFields(t *testing.T) {
+	var fields = make(map[string]datadip.ArchitectField)
+	for _, f := range datadip.ArchitectFields(datadip.AccountResponse{}) {
+		fields[f.Path] = f
+	}
+	var tests = []struct {
+		path       string
+		collection bool
+		kind       string
+	}{
+		{"Account.Name", false, "String"},
+		{"Account.EmailAddresses.EmailAddress.EmailAddress", true, "String"},
+		{"Account.EmailAddresses.EmailAddress.EmailType", true, "Decimal"},
+	}
+	for _, tt := range tests {
+		if f, ok := fields[tt.path]; !ok || f.Collection != tt.collection || f.Kind != tt.kind {
+			t.Errorf("%s = %+v, %v; want collection %v, kind %s", tt.path, f, ok, tt.collection, tt.kind)
+		}
+	}
+	if _, ok := fields["Account.EmailAddresses"]; ok {
+		t.Error("Account.EmailAddresses is not a leaf field")
+	}
+}
+
+func TestArchitectExpression(t *testing.T) {
+	var email = datadip.ArchitectField{Path: "Account.EmailAddresses.EmailAddress.EmailAddress", Collection: true, Kind: "String"}
+	if got := email.Variable("Flow."); got != "Flow.Account_EmailAddresses_EmailAddress_EmailAddress" {
+		t.Errorf("variable = %q", got)
+	}
+	var want = "If(Count(Flow.Account_EmailAddresses_EmailAddress_EmailAddress) >= 1,\n" +
+		"  If(IsSet(Flow.Account_EmailAddresses_EmailAddress_EmailAddress[0]), Flow.Account_EmailAddresses_EmailAddress_EmailAddress[0], \"\"),\n" +
+		"  \"\")"
+	if got := email.Expression("Flow."); got != want {
+		t.Errorf("collection expression =\n%s\nwant\n%s", got, want)
+	}
+
+	var name = datadip.ArchitectField{Path: "Account.Name", Kind: "String"}
+	if got := name.Expression("Task.dip_"); got != `If(IsSet(Task.dip_Account_Name), Task.dip_Account_Name, "")` {
+		t.Errorf("scalar expression = %s", got)
+	}
+
+	var defaults = map[string]string{"String": `""`, "Integer": "0", "Decimal": "0.0", "Boolean": "false"}
+	for kind, want := range defaults {
+		var f = datadip.ArchitectField{Path: "Contact.Field", Kind: kind}
+		if got := f.DefaultValue(); got != want {
+			t.Errorf("default value of a %s = %s, want %s", kind, got, want)
+		}
+		if got := f.Expression(""); got != "If(IsSet(Contact_Field), Contact_Field, "+want+")" {
+			t.Errorf("expression of a %s = %s", kind, got)
+		}
+	}
+}
+
+func TestWriteExpressions(t *testing.T) {
+	var buf bytes.Buffer
+	datadip.WriteExpressions(&buf, datadip.ContactResponse{}, "Flow.")
+	var out = buf.String()
+	for _, want := range []string{
+		"// Contact.FullName (String) in Flow.Contact_FullName\nIf(IsSet(Flow.Contact_FullName), Flow.Contact_FullName, \"\")\n\n",
+		"// Contact.PhoneNumbers.PhoneNumber.Number (String collection) in Flow.Contact_PhoneNumbers_PhoneNumber_Number\nIf(Count(",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expressions do not hold %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package datadip
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// StatusError is returned by a Client when the service replies with a status other than 200 OK or 404 Not Found.
+// The connector takes its failure path on any of them.
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("data dip service replied %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("data dip service replied %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Client calls a data dip web service the way PureCloud Web Services Data Dip Connector does. It answers lookups
+// with ErrNotFound when the service replies 404 Not Found and with a *StatusError for other failures. A fallback reply
+// from the service comes back as an empty record. Client is a CaseStore, so one service can be the backend of another.
+type Client struct {
+	// BaseURL is the URL the actions are served under, as configured on the connector, e.g. "https://host:8443"
+	BaseURL string
+	// Username and Password are sent with HTTP Basic authentication if either is set
+	Username string
+	Password string
+	// Timeout is how long to wait for each reply, like the connector's timeout. It defaults to DefaultTimeout.
+	Timeout time.Duration
+	// HTTPClient sends the requests. It defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// NewClient returns a Client for the service at baseURL.
+func NewClient(baseURL string) *Client {
+	return &Client{BaseURL: baseURL}
+}
+
+// GetAccountByAccountNumber calls the GetAccountByAccountNumber action.
+func (c *Client) GetAccountByAccountNumber(ctx context.Context, accountNumber string) (*Account, error) {
+	var resp AccountResponse
+	if err := c.Do(ctx, ActionGetAccountByAccountNumber, AccountByAccountNumberRequest{AccountNumber: accountNumber}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Account, nil
+}
+
+// GetAccountByContactID calls the GetAccountByContactId action.
+func (c *Client) GetAccountByContactID(ctx context.Context, contactID string) (*Account, error) {
+	var resp AccountResponse
+	if err := c.Do(ctx, ActionGetAccountByContactID, AccountByContactIDRequest{ContactID: contactID}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Account, nil
+}
+
+// GetAccountByPhoneNumber calls the GetAccountByPhoneNumber action.
+func (c *Client) GetAccountByPhoneNumber(ctx context.Context, phoneNumber string) (*Account, error) {
+	var resp AccountResponse
+	if err := c.Do(ctx, ActionGetAccountByPhoneNumber, AccountByPhoneNumberRequest{PhoneNumber: phoneNumber}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Account, nil
+}
+
+// GetContactByPhoneNumber calls the GetContactByPhoneNumber action.
+func (c *Client) GetContactByPhoneNumber(ctx context.Context, phoneNumber string) (*Contact, error) {
+	var resp ContactResponse
+	if err := c.Do(ctx, ActionGetContactByPhoneNumber, ContactByPhoneNumberRequest{PhoneNumber: phoneNumber}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Contact, nil
+}
+
+// GetMostRecentOpenCaseByContactID calls the GetMostRecentOpenCaseByContactId action.
+func (c *Client) GetMostRecentOpenCaseByContactID(ctx context.Context, contactID string) (*Case, error) {
+	var resp CaseResponse
+	if err := c.Do(ctx, ActionGetMostRecentOpenCaseByContactID, MostRecentOpenCaseByContactIDRequest{ContactID: contactID}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Case, nil
+}
+
+// Do POSTs req to action as JSON and decodes the reply into resp. Use it to send requests the typed methods do not,
+// e.g. ones with a CustomAttribute.
+func (c *Client) Do(ctx context.Context, action string, req, resp interface{}) error {
+	var res, body, err = c.Post(ctx, action, req)
+	if err != nil {
+		return err
+	}
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return ErrNotFound
+	default:
+		return &StatusError{StatusCode: res.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+	if err = json.Unmarshal(body, resp); err != nil {
+		return fmt.Errorf("decoding %s reply: %s", action, err)
+	}
+	return nil
+}
+
+// Post POSTs req to action as JSON, with the headers and credentials the connector sends, and returns the reply and
+// its body whatever its status. It gives up after Timeout. Use it to see the raw reply the connector would get.
+func (c *Client) Post(ctx context.Context, action string, req interface{}) (*http.Response, []byte, error) {
+	var err error
+
+	var timeout = c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Build the request the connector would send
+	var b []byte
+	if b, err = json.Marshal(req); err != nil {
+		return nil, nil, err
+	}
+	var r *http.Request
+	if r, err = http.NewRequest("POST", strings.TrimRight(c.BaseURL, "/")+"/"+action, bytes.NewReader(b)); err != nil {
+		return nil, nil, err
+	}
+	r = r.WithContext(ctx)
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Accept", "application/json")
+	if c.Username != "" || c.Password != "" {
+		r.SetBasicAuth(c.Username, c.Password)
+	}
+
+	// Send it and read the reply
+	var httpClient = c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	var res *http.Response
+	if res, err = httpClient.Do(r); err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+	var body []byte
+	if body, err = ioutil.ReadAll(res.Body); err != nil {
+		return nil, nil, err
+	}
+	return res, body, nil
+}
@@ -0,0 +1,101 @@
+package datadip_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"purecloudwebservice/datadip"
+	"purecloudwebservice/datadip/datadiptest"
+)
+
+// requireUser is a Middleware that only lets through requests from user with password
+func requireUser(user, password string) datadip.Middleware {
+	return func(action string, next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if u, p, ok := r.BasicAuth(); !ok || u != user || p != password {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestClient(t *testing.T) {
+	var server = httptest.NewServer(datadip.NewHandler(datadiptest.NewStore(), datadip.WithMiddleware(requireUser("purecloud", "secret"))))
+	defer server.Close()
+	var c = datadip.NewClient(server.URL)
+	c.Username, c.Password = "purecloud", "secret"
+	var ctx = context.Background()
+
+	var account, err = c.GetAccountByAccountNumber(ctx, "123")
+	if err != nil || account.Name != "Ng Sze Min" {
+		t.Errorf("GetAccountByAccountNumber = %+v, %v", account, err)
+	}
+	var contact *datadip.Contact
+	if contact, err = c.GetContactByPhoneNumber(ctx, "+60327763333"); err != nil || contact.ID != "2" {
+		t.Errorf("GetContactByPhoneNumber = %+v, %v", contact, err)
+	}
+	var openCase *datadip.Case
+	if openCase, err = c.GetMostRecentOpenCaseByContactID(ctx, "2"); err != nil || openCase.ID != "3" {
+		t.Errorf("GetMostRecentOpenCaseByContactID = %+v, %v", openCase, err)
+	}
+	if _, err = c.GetAccountByAccountNumber(ctx, "999"); err != datadip.ErrNotFound {
+		t.Errorf("unknown account: err = %v, want %v", err, datadip.ErrNotFound)
+	}
+
+	// Post returns the reply as sent, whatever its status
+	var res, body, postErr = c.Post(ctx, datadip.ActionGetAccountByAccountNumber, map[string]string{"AccountNumber": "999"})
+	if postErr != nil || res.StatusCode != http.StatusNotFound || strings.TrimSpace(string(body)) != datadip.ErrNotFound.Error() {
+		t.Errorf("Post of an unknown account = %v, %q, %v", res, body, postErr)
+	}
+
+	// Actions the service does not implement fail with their status
+	var lookups = map[string]func() error{
+		"GetAccountByContactID":   func() error { _, err := c.GetAccountByContactID(ctx, "2"); return err },
+		"GetAccountByPhoneNumber": func() error { _, err := c.GetAccountByPhoneNumber(ctx, "+60327763333"); return err },
+	}
+	for name, lookup := range lookups {
+		var err = lookup()
+		if se, ok := err.(*datadip.StatusError); !ok || se.StatusCode != http.StatusNotImplemented {
+			t.Errorf("%s: err = %v, want status %d", name, err, http.StatusNotImplemented)
+		}
+	}
+
+	// Wrong credentials
+	c.Password = "guess"
+	if _, err = c.GetAccountByAccountNumber(ctx, "123"); err == nil {
+		t.Error("wrong password: no error")
+	} else if se, ok := err.(*datadip.StatusError); !ok || se.StatusCode != http.StatusUnauthorized {
+		t.Errorf("wrong password: err = %v, want status %d", err, http.StatusUnauthorized)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	var server = httptest.NewServer(datadip.NewHandler(&datadiptest.Store{Delay: time.Second}))
+	defer server.Close()
+	var c = datadip.NewClient(server.URL)
+	c.Timeout = 20 * time.Millisecond
+
+	var start = time.Now()
+	if _, err := c.GetAccountByAccountNumber(context.Background(), "123"); err == nil {
+		t.Fatal("no error")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("gave up after %s, want about %s", elapsed, c.Timeout)
+	}
+}
+
+func TestClientFallback(t *testing.T) {
+	var server = httptest.NewServer(datadip.NewHandler(&datadiptest.Store{Err: datadip.ErrUnavailable}))
+	defer server.Close()
+
+	var contact, err = datadip.NewClient(server.URL).GetContactByPhoneNumber(context.Background(), "+60327763333")
+	if err != nil || *contact != (datadip.Contact{}) {
+		t.Errorf("GetContactByPhoneNumber = %+v, %v; want an empty contact", contact, err)
+	}
+}
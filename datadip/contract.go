@@ -0,0 +1,130 @@
+// Package datadip implements the service contract of the PureCloud Web Services Data Dip Connector, so that any Go
+// service can answer the connector's requests. It has the request and response types, a Store interface for the
+// backend that answers lookups, and a Handler that serves the connector's actions against a Store.
+//
+// The contract is described in https://developer.mypurecloud.com/api/webservice-datadip/service-contracts.html
+package datadip
+
+// AccountResponse contains account information sent back to PureCloud Web Services Data Dip Connector.
+// It follows the format in https://developer.mypurecloud.com/api/webservice-datadip/service-contracts.html
+type AccountResponse struct {
+	Account Account `json:"Account"`
+}
+
+type Account struct {
+	ID              string          `json:"Id,omitempty"`
+	Name            string          `json:"Name,omitempty"`
+	Number          string          `json:"Number,omitempty"`
+	EmailAddresses  *EmailAddresses `json:"EmailAddresses,omitempty"`
+	PhoneNumbers    *PhoneNumbers   `json:"PhoneNumbers,omitempty"`
+	Addresses       *Addresses      `json:"Addresses,omitempty"`
+	CustomAttribute string          `json:"CustomAttribute,omitempty"`
+}
+
+// ContactResponse contains contact information sent back to PureCloud Web Services Data Dip Connector.
+// It follows the format in https://developer.mypurecloud.com/api/webservice-datadip/service-contracts.html
+type ContactResponse struct {
+	Contact Contact `json:"Contact"`
+}
+
+type Contact struct {
+	EmailAddresses  *EmailAddresses `json:"EmailAddresses,omitempty"`
+	FirstName       string          `json:"FirstName,omitempty"`
+	LastName        string          `json:"LastName,omitempty"`
+	FullName        string          `json:"FullName,omitempty"`
+	ID              string          `json:"Id,omitempty"`
+	PhoneNumbers    *PhoneNumbers   `json:"PhoneNumbers,omitempty"`
+	Address         *Address        `json:"Address,omitempty"`
+	CustomAttribute string          `json:"CustomAttribute,omitempty"`
+}
+
+// CaseResponse contains case information sent back to PureCloud Web Services Data Dip Connector.
+// It follows the format in https://developer.mypurecloud.com/api/webservice-datadip/service-contracts.html
+type CaseResponse struct {
+	Case Case `json:"Case"`
+}
+
+type Case struct {
+	ID              string `json:"Id,omitempty"`
+	Number          string `json:"Number,omitempty"`
+	Subject         string `json:"Subject,omitempty"`
+	Description     string `json:"Description,omitempty"`
+	Status          string `json:"Status,omitempty"`
+	Priority        string `json:"Priority,omitempty"`
+	CreatedDate     string `json:"CreatedDate,omitempty"`
+	ContactID       string `json:"ContactId,omitempty"`
+	CustomAttribute string `json:"CustomAttribute,omitempty"`
+}
+
+type Addresses struct {
+	Address []Address `json:"Address,omitempty"`
+}
+
+type Address struct {
+	City       string `json:"City,omitempty"`
+	Country    string `json:"Country,omitempty"`
+	Line1      string `json:"Line1,omitempty"`
+	Line2      string `json:"Line2,omitempty"`
+	Line3      string `json:"Line3,omitempty"`
+	PostalCode string `json:"PostalCode,omitempty"`
+	State      string `json:"State,omitempty"`
+	Type       string `json:"Type,omitempty"`
+}
+
+type EmailAddresses struct {
+	EmailAddress []EmailAddress `json:"EmailAddress,omitempty"`
+}
+
+type EmailAddress struct {
+	EmailAddress string  `json:"EmailAddress,omitempty"`
+	EmailType    float32 `json:"EmailType,omitempty"`
+}
+
+type PhoneNumbers struct {
+	PhoneNumbers []PhoneNumber `json:"PhoneNumber,omitempty"`
+}
+
+type PhoneNumber struct {
+	Number    string  `json:"Number,omitempty"`
+	PhoneType float32 `json:"PhoneType,omitempty"`
+}
+
+// AccountByAccountNumberRequest is the request sent from PureCloud Web Services Data Dip Connector to this app to retrieve
+// account information using an account number to query
+// It follows the format in https://developer.mypurecloud.com/api/webservice-datadip/service-contracts.html
+type AccountByAccountNumberRequest struct {
+	AccountNumber   string `json:"AccountNumber"`
+	CustomAttribute string `json:"CustomAttribute,omitempty"`
+}
+
+// ContactByPhoneNumberRequest is the request sent from PureCloud Web Services Data Dip Connector to this app to retrieve
+// contact information using a phone number to query
+// It follows the format in https://developer.mypurecloud.com/api/webservice-datadip/service-contracts.html
+type ContactByPhoneNumberRequest struct {
+	PhoneNumber     string `json:"PhoneNumber"`
+	CustomAttribute string `json:"CustomAttribute,omitempty"`
+}
+
+// AccountByContactIDRequest is the request sent from PureCloud Web Services Data Dip Connector to this app to retrieve
+// account information using a contact id to query
+// It follows the format in https://developer.mypurecloud.com/api/webservice-datadip/service-contracts.html
+type AccountByContactIDRequest struct {
+	ContactID       string `json:"ContactId"`
+	CustomAttribute string `json:"CustomAttribute,omitempty"`
+}
+
+// AccountByPhoneNumberRequest is the request sent from PureCloud Web Services Data Dip Connector to this app to retrieve
+// account information using a phone number to query
+// It follows the format in https://developer.mypurecloud.com/api/webservice-datadip/service-contracts.html
+type AccountByPhoneNumberRequest struct {
+	PhoneNumber     string `json:"PhoneNumber"`
+	CustomAttribute string `json:"CustomAttribute,omitempty"`
+}
+
+// MostRecentOpenCaseByContactIDRequest is the request sent from PureCloud Web Services Data Dip Connector to this app to
+// retrieve the most recent open case of a contact using a contact id to query
+// It follows the format in https://developer.mypurecloud.com/api/webservice-datadip/service-contracts.html
+type MostRecentOpenCaseByContactIDRequest struct {
+	ContactID       string `json:"ContactId"`
+	CustomAttribute string `json:"CustomAttribute,omitempty"`
+}
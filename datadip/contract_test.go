@@ -0,0 +1,29 @@
+package datadip_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"purecloudwebservice/datadip"
+)
+
+// TestContractJSON pins the JSON sent to the connector. Fields left empty, including a contact's PhoneNumbers and an
+// EmailType of 0, are left out rather than sent as null or 0.
+func TestContractJSON(t *testing.T) {
+	var tests = []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"empty contact", datadip.ContactResponse{}, `{"Contact":{}}`},
+		{"contact", datadip.ContactResponse{Contact: datadip.Contact{ID: "2", PhoneNumbers: &datadip.PhoneNumbers{PhoneNumbers: []datadip.PhoneNumber{{Number: "+60327763333", PhoneType: 1}}}}},
+			`{"Contact":{"Id":"2","PhoneNumbers":{"PhoneNumber":[{"Number":"+60327763333","PhoneType":1}]}}}`},
+		{"email address without a type", datadip.EmailAddress{EmailAddress: "szemin.ng@inin.com"}, `{"EmailAddress":"szemin.ng@inin.com"}`},
+		{"email address", datadip.EmailAddress{EmailAddress: "szemin.ng@inin.com", EmailType: 2}, `{"EmailAddress":"szemin.ng@inin.com","EmailType":2}`},
+	}
+	for _, tt := range tests {
+		if b, err := json.Marshal(tt.value); err != nil || string(b) != tt.want {
+			t.Errorf("%s = %s, %v; want %s", tt.name, b, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Package datadiptest provides a Store and helpers for testing data dip handlers and the stores and routers built on
+// them.
+package datadiptest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"purecloudwebservice/datadip"
+)
+
+// Store is a datadip.CaseStore holding the records set by a test. Every lookup waits for Delay, unless its context is done
+// first, then fails with Err if it is set. Cases holds each contact's most recent open case, by contact id.
+type Store struct {
+	Accounts map[string]*datadip.Account
+	Contacts map[string]*datadip.Contact
+	Cases    map[string]*datadip.Case
+	Err      error
+	Delay    time.Duration
+	// Hook, if set, is called with the context and key of every lookup after Delay, e.g. to block or to fail some
+	// lookups only. An error it returns fails the lookup.
+	Hook func(ctx context.Context, key string) error
+
+	calls int64
+}
+
+// NewStore returns a Store holding one account, number "123", one contact, phone number "+60327763333", and that
+// contact's open case.
+func NewStore() *Store {
+	return &Store{
+		Accounts: map[string]*datadip.Account{
+			"123": {ID: "1", Name: "Ng Sze Min", Number: "123", EmailAddresses: &datadip.EmailAddresses{EmailAddress: []datadip.EmailAddress{{EmailAddress: "szemin.ng@inin.com", EmailType: 1}}}},
+		},
+		Contacts: map[string]*datadip.Contact{
+			"+60327763333": {ID: "2", FullName: "Ng Sze Min", PhoneNumbers: &datadip.PhoneNumbers{PhoneNumbers: []datadip.PhoneNumber{{Number: "+60327763333", PhoneType: 1}}}},
+		},
+		Cases: map[string]*datadip.Case{
+			"2": {ID: "3", Number: "00001026", Subject: "Billing enquiry", Status: "New", Priority: "Medium", CreatedDate: "2017-03-01T09:00:00Z", ContactID: "2"},
+		},
+	}
+}
+
+// GetAccountByAccountNumber returns the account with accountNumber, or datadip.ErrNotFound.
+func (s *Store) GetAccountByAccountNumber(ctx context.Context, accountNumber string) (*datadip.Account, error) {
+	if err := s.wait(ctx, accountNumber); err != nil {
+		return nil, err
+	}
+	if a, ok := s.Accounts[accountNumber]; ok {
+		return a, nil
+	}
+	return nil, datadip.ErrNotFound
+}
+
+// GetContactByPhoneNumber returns the contact with phoneNumber, or datadip.ErrNotFound.
+func (s *Store) GetContactByPhoneNumber(ctx context.Context, phoneNumber string) (*datadip.Contact, error) {
+	if err := s.wait(ctx, phoneNumber); err != nil {
+		return nil, err
+	}
+	if c, ok := s.Contacts[phoneNumber]; ok {
+		return c, nil
+	}
+	return nil, datadip.ErrNotFound
+}
+
+// GetMostRecentOpenCaseByContactID returns the case held for contactID, or datadip.ErrNotFound.
+func (s *Store) GetMostRecentOpenCaseByContactID(ctx context.Context, contactID string) (*datadip.Case, error) {
+	if err := s.wait(ctx, contactID); err != nil {
+		return nil, err
+	}
+	if c, ok := s.Cases[contactID]; ok {
+		return c, nil
+	}
+	return nil, datadip.ErrNotFound
+}
+
+// Calls returns how many lookups have been made against s.
+func (s *Store) Calls() int {
+	return int(atomic.LoadInt64(&s.calls))
+}
+
+// wait counts a lookup for key and sleeps for the store's delay, then returns its error or the hook's, if any.
+func (s *Store) wait(ctx context.Context, key string) error {
+	atomic.AddInt64(&s.calls, 1)
+	if s.Delay > 0 {
+		select {
+		case <-time.After(s.Delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if s.Hook != nil {
+		if err := s.Hook(ctx, key); err != nil {
+			return err
+		}
+	}
+	return s.Err
+}
+
+// Do sends a request with a JSON body to h and returns the recorded response.
+func Do(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	var req = httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	var rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
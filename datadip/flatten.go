@@ -0,0 +1,167 @@
+package datadip
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// NotSet is how Architect shows a flattened field that has no value
+const NotSet = "NOT_SET"
+
+// Metadata is the flattened view of a response that Architect gets when Flatten metadata is checked on the
+// connector. Values maps each field's flattened name, e.g. "Account.EmailAddresses.EmailAddress[0].EmailAddress", to
+// its value. NotSet lists the fields of the response type that have no value and would come through as NOT_SET;
+// lists with no elements are shown by their first element's fields.
+type Metadata struct {
+	Values map[string]interface{} `json:"values"`
+	NotSet []string               `json:"notSet"`
+}
+
+// Keys returns the names of the fields that have a value, in order.
+func (m *Metadata) Keys() []string {
+	var keys = make([]string, 0, len(m.Values))
+	for k := range m.Values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Flatten returns the flattened view Architect gets of resp, which may be any response type such as AccountResponse
+// or ContactResponse.
+func Flatten(resp interface{}) (*Metadata, error) {
+	var err error
+
+	// Work from the JSON so that fields left out by omitempty are not set, just as the connector sees them
+	var b []byte
+	if b, err = json.Marshal(resp); err != nil {
+		return nil, err
+	}
+	return FlattenJSON(resp, b)
+}
+
+// FlattenJSON returns the flattened view Architect gets of body, a JSON response of the type of response, e.g.
+// AccountResponse{}. If response is nil, the type is not known and NotSet is left empty.
+func FlattenJSON(response interface{}, body []byte) (*Metadata, error) {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return nil, err
+	}
+	if response == nil {
+		return &Metadata{Values: flattenUntyped(v), NotSet: []string{}}, nil
+	}
+	return flattenAs(reflect.TypeOf(response), v), nil
+}
+
+// flattenAs returns the flattened view of v, a decoded JSON response whose fields are those of type t.
+func flattenAs(t reflect.Type, v interface{}) *Metadata {
+	var m = &Metadata{Values: make(map[string]interface{}), NotSet: []string{}}
+	var walk func(path string, t reflect.Type, v interface{})
+	walk = func(path string, t reflect.Type, v interface{}) {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Struct:
+			var obj, _ = v.(map[string]interface{})
+			for _, f := range jsonFields(t) {
+				var p = f.name
+				if path != "" {
+					p = path + "." + f.name
+				}
+				walk(p, f.field.Type, obj[f.name])
+			}
+		case reflect.Slice, reflect.Array:
+			var list, _ = v.([]interface{})
+			if len(list) == 0 {
+				walk(path+"[0]", t.Elem(), nil)
+			}
+			for i, child := range list {
+				walk(fmt.Sprintf("%s[%d]", path, i), t.Elem(), child)
+			}
+		default:
+			if v == nil {
+				m.NotSet = append(m.NotSet, path)
+			} else {
+				m.Values[path] = v
+			}
+		}
+	}
+	walk("", t, v)
+	return m
+}
+
+// flattenUntyped flattens a decoded JSON value of unknown type into a map from dotted paths to leaf values,
+// addressing array elements by index.
+func flattenUntyped(v interface{}) map[string]interface{} {
+	var flat = make(map[string]interface{})
+	var walk func(path string, v interface{})
+	walk = func(path string, v interface{}) {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			for k, child := range t {
+				var p = k
+				if path != "" {
+					p = path + "." + k
+				}
+				walk(p, child)
+			}
+		case []interface{}:
+			for i, child := range t {
+				walk(fmt.Sprintf("%s[%d]", path, i), child)
+			}
+		default:
+			flat[path] = t
+		}
+	}
+	walk("", v)
+	return flat
+}
+
+// PreviewHandler returns a handler for HTTP POSTs to a path ending in an action's name, e.g.
+// /debug/metadata/GetAccountByAccountNumber. It sends the request body to the action through h, as the connector
+// would, and replies with the action's response and its flattened view.
+func PreviewHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var info, ok = FindAction(path.Base(r.URL.Path))
+		if !ok || !info.Implemented {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintln(w, "unknown or unimplemented action")
+			return
+		}
+
+		// Run the action
+		var req, err = http.NewRequest("POST", "/"+info.Name, r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintln(w, err)
+			return
+		}
+		req = req.WithContext(r.Context())
+		req.Header = r.Header
+		var rec = NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		var preview struct {
+			Status   int             `json:"status"`
+			Response json.RawMessage `json:"response,omitempty"`
+			Metadata *Metadata       `json:"metadata,omitempty"`
+			Error    string          `json:"error,omitempty"`
+		}
+		preview.Status = rec.Status
+		var m *Metadata
+		m, err = FlattenJSON(info.Response, rec.Body.Bytes())
+		if rec.Status == http.StatusOK && err == nil {
+			preview.Response = json.RawMessage(rec.Body.Bytes())
+			preview.Metadata = m
+		} else {
+			preview.Error = strings.TrimSpace(rec.Body.String())
+		}
+		writeJSON(w, preview)
+	})
+}
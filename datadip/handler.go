@@ -0,0 +1,323 @@
+package datadip
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// DefaultTimeout bounds how long a Handler waits for the store, so that a slow backend cannot hold handler goroutines
+// indefinitely
+const DefaultTimeout = 5 * time.Second
+
+// Middleware wraps the handler of one action, e.g. to authenticate, log or record its requests. action is the name
+// of the action being served. The request body it reads is cut off one byte past the action's body limit, so that
+// middleware keeping a copy of the body holds no more than the action reads.
+type Middleware func(action string, next http.Handler) http.Handler
+
+// Option configures a Handler
+type Option func(*Handler)
+
+// WithTimeout sets how long actions wait for their store. It defaults to DefaultTimeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(h *Handler) {
+		h.timeout = timeout
+	}
+}
+
+// WithRoute answers action from store instead of the Handler's store, waiting for it for timeout. A zero timeout
+// leaves the Handler's timeout in place.
+func WithRoute(action string, store Store, timeout time.Duration) Option {
+	return func(h *Handler) {
+		h.routes[action] = route{store: store, timeout: timeout}
+	}
+}
+
+// WithMiddleware wraps every action in middleware. The first middleware given is the outermost.
+func WithMiddleware(middleware ...Middleware) Option {
+	return func(h *Handler) {
+		h.middleware = append(h.middleware, middleware...)
+	}
+}
+
+// Decorator changes an action's response after its lookup has found a record, e.g. to compute its CustomAttribute.
+// req points to the action's request, e.g. *AccountByAccountNumberRequest, and resp to its response, e.g.
+// *AccountResponse.
+type Decorator func(req, resp interface{})
+
+// WithDecorator runs decorator on every response to action that holds a record found by the store. Fallback responses
+// are not decorated. Decorators run in the order given.
+func WithDecorator(action string, decorator Decorator) Option {
+	return func(h *Handler) {
+		h.decorators[action] = append(h.decorators[action], decorator)
+	}
+}
+
+// route is how an implemented action is answered: the store to look up and how long to wait for it
+type route struct {
+	store   Store
+	timeout time.Duration
+}
+
+// Handler is an http.Handler that answers PureCloud Web Services Data Dip Connector requests. Each action is served
+// at "/" + its name and takes HTTP POSTs only.
+//
+// A request that fails its action's Validation replies 400 Bad Request with a JSON list of the problems, e.g.
+// {"errors":[{"field":"AccountNumber","message":"is required"}]}. A lookup that finds no record replies 404 Not Found
+// and one that fails replies 500 Internal Server Error, so that the connector takes its failure path. A lookup
+// answered with ErrUnavailable replies 200 OK with an empty record.
+type Handler struct {
+	store      Store
+	timeout    time.Duration
+	routes     map[string]route
+	validation map[string]Validation
+	decorators map[string][]Decorator
+	middleware []Middleware
+	router     *mux.Router
+}
+
+// NewHandler returns a Handler that answers every implemented action from store.
+func NewHandler(store Store, options ...Option) *Handler {
+	var h = &Handler{store: store, timeout: DefaultTimeout, routes: make(map[string]route), validation: make(map[string]Validation), decorators: make(map[string][]Decorator)}
+	for _, o := range options {
+		o(h)
+	}
+
+	h.router = mux.NewRouter()
+	h.handle(ActionGetAccountByAccountNumber, h.getAccountByAccountNumber)
+	h.handle(ActionGetAccountByContactID, getAccountByContactID)
+	h.handle(ActionGetAccountByPhoneNumber, getAccountByPhoneNumber)
+	h.handle(ActionGetContactByPhoneNumber, h.getContactByPhoneNumber)
+	h.handle(ActionGetMostRecentOpenCaseByContactID, h.getMostRecentOpenCaseByContactID)
+	return h
+}
+
+// ServeHTTP dispatches r to the action named by its path.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.router.ServeHTTP(w, r)
+}
+
+// handle serves action with fn wrapped in the Handler's middleware, with the request body cut off just past the
+// action's limit before any of them reads it.
+func (h *Handler) handle(action string, fn http.HandlerFunc) {
+	var handler http.Handler = fn
+	for i := len(h.middleware) - 1; i >= 0; i-- {
+		handler = h.middleware[i](action, handler)
+	}
+	var max = h.validation[action].maxBodySize()
+	var limited = handler
+	handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, max+1)
+		limited.ServeHTTP(w, r)
+	})
+	h.router.Handle("/"+action, handler).Methods("POST")
+}
+
+// route returns the store and timeout action is answered with.
+func (h *Handler) route(action string) route {
+	var rt, ok = h.routes[action]
+	if !ok {
+		rt.store = h.store
+	}
+	if rt.timeout <= 0 {
+		rt.timeout = h.timeout
+	}
+	return rt
+}
+
+// decorate runs action's decorators on req and resp.
+func (h *Handler) decorate(action string, req, resp interface{}) {
+	for _, d := range h.decorators[action] {
+		d(req, resp)
+	}
+}
+
+// getAccountByAccountNumber handles HTTP POSTs to /GetAccountByAccountNumber. It reads the request sent, looks up the
+// account in the store and returns a response
+func (h *Handler) getAccountByAccountNumber(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	log.Println("Processing /GetAccountByAccountNumber...")
+
+	// Retrieve request body
+	var req AccountByAccountNumberRequest
+	if err = h.validation[ActionGetAccountByAccountNumber].decode(r, &req); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	// Look up account. If the backend is unavailable, fail fast with the fallback response, an empty account
+	var rt = h.route(ActionGetAccountByAccountNumber)
+	var ctx, cancel = context.WithTimeout(r.Context(), rt.timeout)
+	defer cancel()
+	var resp AccountResponse
+	var account *Account
+	switch account, err = rt.store.GetAccountByAccountNumber(ctx, req.AccountNumber); err {
+	case nil:
+		resp.Account = *account
+		h.decorate(ActionGetAccountByAccountNumber, &req, &resp)
+	case ErrUnavailable:
+		log.Println("Backend unavailable, sending fallback reply from /GetAccountByAccountNumber...")
+		writeJSON(w, resp)
+		return
+	default:
+		writeLookupError(w, err)
+		return
+	}
+
+	log.Println("Sending reply from /GetAccountByAccountNumber...")
+	writeJSON(w, resp)
+}
+
+func getAccountByContactID(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+	fmt.Fprintln(w, http.StatusNotImplemented)
+}
+
+func getAccountByPhoneNumber(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+	fmt.Fprintln(w, http.StatusNotImplemented)
+}
+
+// getContactByPhoneNumber handles HTTP POSTs to /GetContactByPhoneNumber. It reads the request sent, looks up the
+// contact in the store and returns a response
+func (h *Handler) getContactByPhoneNumber(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	log.Println("Processing /GetContactByPhoneNumber...")
+
+	// Retrieve request body
+	var req ContactByPhoneNumberRequest
+	if err = h.validation[ActionGetContactByPhoneNumber].decode(r, &req); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	// Look up contact. If the backend is unavailable, fail fast with the fallback response, an empty contact
+	var rt = h.route(ActionGetContactByPhoneNumber)
+	var ctx, cancel = context.WithTimeout(r.Context(), rt.timeout)
+	defer cancel()
+	var resp ContactResponse
+	var contact *Contact
+	switch contact, err = rt.store.GetContactByPhoneNumber(ctx, req.PhoneNumber); err {
+	case nil:
+		resp.Contact = *contact
+		h.decorate(ActionGetContactByPhoneNumber, &req, &resp)
+	case ErrUnavailable:
+		log.Println("Backend unavailable, sending fallback reply from /GetContactByPhoneNumber...")
+		writeJSON(w, resp)
+		return
+	default:
+		writeLookupError(w, err)
+		return
+	}
+
+	log.Println("Sending reply from /GetContactByPhoneNumber...")
+	writeJSON(w, resp)
+}
+
+// getMostRecentOpenCaseByContactID handles HTTP POSTs to /GetMostRecentOpenCaseByContactId. It reads the request sent,
+// looks up the contact's most recent open case in the store and returns a response
+func (h *Handler) getMostRecentOpenCaseByContactID(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	log.Println("Processing /GetMostRecentOpenCaseByContactId...")
+
+	// Only stores that hold cases answer the action
+	var rt = h.route(ActionGetMostRecentOpenCaseByContactID)
+	var store, ok = rt.store.(CaseStore)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		fmt.Fprintln(w, http.StatusNotImplemented)
+		return
+	}
+
+	// Retrieve request body
+	var req MostRecentOpenCaseByContactIDRequest
+	if err = h.validation[ActionGetMostRecentOpenCaseByContactID].decode(r, &req); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	// Look up case. If the backend is unavailable, fail fast with the fallback response, an empty case
+	var ctx, cancel = context.WithTimeout(r.Context(), rt.timeout)
+	defer cancel()
+	var resp CaseResponse
+	var c *Case
+	switch c, err = store.GetMostRecentOpenCaseByContactID(ctx, req.ContactID); err {
+	case nil:
+		resp.Case = *c
+		h.decorate(ActionGetMostRecentOpenCaseByContactID, &req, &resp)
+	case ErrUnavailable:
+		log.Println("Backend unavailable, sending fallback reply from /GetMostRecentOpenCaseByContactId...")
+		writeJSON(w, resp)
+		return
+	default:
+		writeLookupError(w, err)
+		return
+	}
+
+	log.Println("Sending reply from /GetMostRecentOpenCaseByContactId...")
+	writeJSON(w, resp)
+}
+
+// writeLookupError replies with 404 Not Found if the store has no matching record, or 500 Internal Server Error if the
+// lookup failed
+func writeLookupError(w http.ResponseWriter, err error) {
+	if err == ErrNotFound {
+		log.Println("Lookup found no record")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintln(w, err)
+		return
+	}
+	log.Printf("Failed to look up record: %s\n", err)
+	w.WriteHeader(http.StatusInternalServerError)
+	fmt.Fprintln(w, err)
+}
+
+// writeJSON writes resp as a JSON reply with 200 OK
+func writeJSON(w http.ResponseWriter, resp interface{}) {
+	var err error
+
+	// Write reply
+	var b []byte
+	if b, err = json.Marshal(resp); err != nil {
+		panic(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err = w.Write(b); err != nil {
+		log.Printf("Failed to write: %s\n", err)
+	}
+}
+
+// Recorder is an http.ResponseWriter that keeps the reply in memory, for running a request through a handler
+// in-process, e.g. to preview an action or look up a record from the command line
+type Recorder struct {
+	Status int
+	Body   bytes.Buffer
+	header http.Header
+}
+
+// NewRecorder returns a Recorder whose Status is 200 OK until a handler writes another.
+func NewRecorder() *Recorder {
+	return &Recorder{Status: http.StatusOK, header: make(http.Header)}
+}
+
+func (w *Recorder) Header() http.Header {
+	return w.header
+}
+
+func (w *Recorder) WriteHeader(status int) {
+	w.Status = status
+}
+
+func (w *Recorder) Write(b []byte) (int, error) {
+	return w.Body.Write(b)
+}
@@ -0,0 +1,247 @@
+package datadip_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"purecloudwebservice/datadip"
+	"purecloudwebservice/datadip/datadiptest"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+func TestActions(t *testing.T) {
+	var tests = []struct {
+		name   string
+		store  *datadiptest.Store
+		method string
+		path   string
+		body   string
+		status int
+		want   string
+	}{
+		{"account found", datadiptest.NewStore(), "POST", "/GetAccountByAccountNumber", `{"AccountNumber":"123"}`, http.StatusOK,
+			`{"Account":{"Id":"1","Name":"Ng Sze Min","Number":"123","EmailAddresses":{"EmailAddress":[{"EmailAddress":"szemin.ng@inin.com","EmailType":1}]}}}`},
+		{"account with custom attribute", datadiptest.NewStore(), "POST", "/GetAccountByAccountNumber", `{"AccountNumber":"123","CustomAttribute":"x"}`, http.StatusOK,
+			`{"Account":{"Id":"1","Name":"Ng Sze Min","Number":"123","EmailAddresses":{"EmailAddress":[{"EmailAddress":"szemin.ng@inin.com","EmailType":1}]}}}`},
+		{"account not found", datadiptest.NewStore(), "POST", "/GetAccountByAccountNumber", `{"AccountNumber":"999"}`, http.StatusNotFound, ""},
+		{"account missing number", datadiptest.NewStore(), "POST", "/GetAccountByAccountNumber", `{}`, http.StatusBadRequest, ""},
+		{"account malformed JSON", datadiptest.NewStore(), "POST", "/GetAccountByAccountNumber", `{"AccountNumber":`, http.StatusBadRequest, ""},
+		{"account empty body", datadiptest.NewStore(), "POST", "/GetAccountByAccountNumber", ``, http.StatusBadRequest, ""},
+		{"account backend error", &datadiptest.Store{Err: errors.New("crm down")}, "POST", "/GetAccountByAccountNumber", `{"AccountNumber":"123"}`, http.StatusInternalServerError, ""},
+		{"account backend unavailable", &datadiptest.Store{Err: datadip.ErrUnavailable}, "POST", "/GetAccountByAccountNumber", `{"AccountNumber":"123"}`, http.StatusOK, `{"Account":{}}`},
+		{"account backend timeout", &datadiptest.Store{Delay: time.Second}, "POST", "/GetAccountByAccountNumber", `{"AccountNumber":"123"}`, http.StatusInternalServerError, ""},
+		{"contact found", datadiptest.NewStore(), "POST", "/GetContactByPhoneNumber", `{"PhoneNumber":"+60327763333"}`, http.StatusOK,
+			`{"Contact":{"FullName":"Ng Sze Min","Id":"2","PhoneNumbers":{"PhoneNumber":[{"Number":"+60327763333","PhoneType":1}]}}}`},
+		{"contact not found", datadiptest.NewStore(), "POST", "/GetContactByPhoneNumber", `{"PhoneNumber":"+1"}`, http.StatusNotFound, ""},
+		{"contact missing number", datadiptest.NewStore(), "POST", "/GetContactByPhoneNumber", `{}`, http.StatusBadRequest, ""},
+		{"contact malformed JSON", datadiptest.NewStore(), "POST", "/GetContactByPhoneNumber", `[1,2`, http.StatusBadRequest, ""},
+		{"contact backend error", &datadiptest.Store{Err: errors.New("crm down")}, "POST", "/GetContactByPhoneNumber", `{"PhoneNumber":"+60327763333"}`, http.StatusInternalServerError, ""},
+		{"contact backend unavailable", &datadiptest.Store{Err: datadip.ErrUnavailable}, "POST", "/GetContactByPhoneNumber", `{"PhoneNumber":"+60327763333"}`, http.StatusOK, `{"Contact":{}}`},
+		{"contact backend timeout", &datadiptest.Store{Delay: time.Second}, "POST", "/GetContactByPhoneNumber", `{"PhoneNumber":"+60327763333"}`, http.StatusInternalServerError, ""},
+		{"case found", datadiptest.NewStore(), "POST", "/GetMostRecentOpenCaseByContactId", `{"ContactId":"2"}`, http.StatusOK,
+			`{"Case":{"Id":"3","Number":"00001026","Subject":"Billing enquiry","Status":"New","Priority":"Medium","CreatedDate":"2017-03-01T09:00:00Z","ContactId":"2"}}`},
+		{"case not found", datadiptest.NewStore(), "POST", "/GetMostRecentOpenCaseByContactId", `{"ContactId":"9"}`, http.StatusNotFound, ""},
+		{"case missing contact id", datadiptest.NewStore(), "POST", "/GetMostRecentOpenCaseByContactId", `{}`, http.StatusBadRequest, ""},
+		{"case backend unavailable", &datadiptest.Store{Err: datadip.ErrUnavailable}, "POST", "/GetMostRecentOpenCaseByContactId", `{"ContactId":"2"}`, http.StatusOK, `{"Case":{}}`},
+		{"account by contact id not implemented", datadiptest.NewStore(), "POST", "/GetAccountByContactId", `{"ContactId":"2"}`, http.StatusNotImplemented, ""},
+		{"account by phone number not implemented", datadiptest.NewStore(), "POST", "/GetAccountByPhoneNumber", `{"PhoneNumber":"+60327763333"}`, http.StatusNotImplemented, ""},
+		// The router only matches routes with the right method, so other methods are not found
+		{"wrong method", datadiptest.NewStore(), "GET", "/GetAccountByAccountNumber", ``, http.StatusNotFound, ""},
+		{"wrong method on stub", datadiptest.NewStore(), "PUT", "/GetAccountByContactId", ``, http.StatusNotFound, ""},
+		{"unknown action", datadiptest.NewStore(), "POST", "/GetEverything", `{}`, http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rec = datadiptest.Do(datadip.NewHandler(tt.store, datadip.WithTimeout(50*time.Millisecond)), tt.method, tt.path, tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d; body %q", rec.Code, tt.status, rec.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+			if got := rec.Body.String(); got != tt.want {
+				t.Errorf("body = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// accountStore is a Store that holds no cases, as Stores written before the case action was added
+type accountStore struct {
+	store *datadiptest.Store
+}
+
+func (s accountStore) GetAccountByAccountNumber(ctx context.Context, accountNumber string) (*datadip.Account, error) {
+	return s.store.GetAccountByAccountNumber(ctx, accountNumber)
+}
+
+func (s accountStore) GetContactByPhoneNumber(ctx context.Context, phoneNumber string) (*datadip.Contact, error) {
+	return s.store.GetContactByPhoneNumber(ctx, phoneNumber)
+}
+
+func TestCaseStore(t *testing.T) {
+	var h = datadip.NewHandler(accountStore{datadiptest.NewStore()})
+	if rec := datadiptest.Do(h, "POST", "/GetMostRecentOpenCaseByContactId", `{"ContactId":"2"}`); rec.Code != http.StatusNotImplemented {
+		t.Errorf("case from a Store: status = %d, want %d", rec.Code, http.StatusNotImplemented)
+	}
+	if rec := datadiptest.Do(h, "POST", "/GetAccountByAccountNumber", `{"AccountNumber":"123"}`); rec.Code != http.StatusOK {
+		t.Errorf("account from a Store: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestWithRoute(t *testing.T) {
+	var other = &datadiptest.Store{Accounts: map[string]*datadip.Account{"123": {Name: "Other"}}}
+	var h = datadip.NewHandler(datadiptest.NewStore(), datadip.WithRoute(datadip.ActionGetAccountByAccountNumber, other, 0))
+
+	if rec := datadiptest.Do(h, "POST", "/GetAccountByAccountNumber", `{"AccountNumber":"123"}`); rec.Body.String() != `{"Account":{"Name":"Other"}}` {
+		t.Errorf("routed action: body = %s", rec.Body.String())
+	}
+	if rec := datadiptest.Do(h, "POST", "/GetContactByPhoneNumber", `{"PhoneNumber":"+60327763333"}`); rec.Code != http.StatusOK {
+		t.Errorf("other action: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestWithMiddleware(t *testing.T) {
+	var calls []string
+	var mw = func(name string) datadip.Middleware {
+		return func(action string, next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name+" "+action)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	var h = datadip.NewHandler(datadiptest.NewStore(), datadip.WithMiddleware(mw("outer"), mw("inner")))
+
+	datadiptest.Do(h, "POST", "/GetAccountByAccountNumber", `{"AccountNumber":"123"}`)
+	datadiptest.Do(h, "POST", "/GetAccountByContactId", `{}`)
+	var want = "outer GetAccountByAccountNumber,inner GetAccountByAccountNumber,outer GetAccountByContactId,inner GetAccountByContactId"
+	if got := strings.Join(calls, ","); got != want {
+		t.Errorf("calls = %s, want %s", got, want)
+	}
+}
+
+func TestWithDecorator(t *testing.T) {
+	var h = datadip.NewHandler(datadiptest.NewStore(),
+		datadip.WithDecorator(datadip.ActionGetAccountByAccountNumber, func(req, resp interface{}) {
+			resp.(*datadip.AccountResponse).Account.CustomAttribute = "for " + req.(*datadip.AccountByAccountNumberRequest).AccountNumber
+		}),
+		datadip.WithDecorator(datadip.ActionGetAccountByAccountNumber, func(req, resp interface{}) {
+			resp.(*datadip.AccountResponse).Account.CustomAttribute += "!"
+		}))
+
+	if rec := datadiptest.Do(h, "POST", "/GetAccountByAccountNumber", `{"AccountNumber":"123"}`); !strings.Contains(rec.Body.String(), `"CustomAttribute":"for 123!"`) {
+		t.Errorf("decorated response = %s", rec.Body.String())
+	}
+	if rec := datadiptest.Do(h, "POST", "/GetContactByPhoneNumber", `{"PhoneNumber":"+60327763333"}`); strings.Contains(rec.Body.String(), "CustomAttribute") {
+		t.Errorf("other action's response = %s", rec.Body.String())
+	}
+	h = datadip.NewHandler(&datadiptest.Store{Err: datadip.ErrUnavailable}, datadip.WithDecorator(datadip.ActionGetAccountByAccountNumber, func(req, resp interface{}) {
+		t.Error("fallback response decorated")
+	}))
+	datadiptest.Do(h, "POST", "/GetAccountByAccountNumber", `{"AccountNumber":"123"}`)
+}
+
+func TestWithValidation(t *testing.T) {
+	var h = datadip.NewHandler(datadiptest.NewStore(), datadip.WithValidation(datadip.ActionGetAccountByAccountNumber, datadip.Validation{
+		MaxBodySize:           64,
+		DisallowUnknownFields: true,
+		Fields: map[string]datadip.FieldRule{
+			"AccountNumber":   {Pattern: regexp.MustCompile(`^[0-9]+$`), MaxLength: 6},
+			"CustomAttribute": {MinLength: 2},
+		},
+	}))
+
+	var tests = []struct {
+		name string
+		body string
+		want string
+	}{
+		{"valid", `{"AccountNumber":"123","CustomAttribute":"ab"}`, ""},
+		{"every rule broken", `{"AccountNumber":"12345x7","CustomAttribute":"a"}`,
+			`[{"field":"AccountNumber","message":"must be at most 6 characters"},{"field":"AccountNumber","message":"must match ^[0-9]+$"},` +
+				`{"field":"CustomAttribute","message":"must be at least 2 characters"}]`},
+		{"pattern matches only part", `{"AccountNumber":"12a"}`, `[{"field":"AccountNumber","message":"must match ^[0-9]+$"}]`},
+		{"required field empty", `{"AccountNumber":""}`, `[{"field":"AccountNumber","message":"is required"}]`},
+		{"unknown field", `{"AccountNumber":"123","Acount":"1"}`, `[{"field":"Acount","message":"is not a field of the request"}]`},
+		{"wrong type", `{"AccountNumber":123}`, `[{"field":"AccountNumber","message":"must be a string, not a number"}]`},
+		{"not an object", `["123"]`, `[{"field":"","message":"body must be a JSON object"}]`},
+		{"body too large", `{"AccountNumber":"123","CustomAttribute":"` + strings.Repeat("x", 64) + `"}`, `[{"field":"","message":"body must be at most 64 bytes"}]`},
+	}
+	for _, tt := range tests {
+		var rec = datadiptest.Do(h, "POST", "/GetAccountByAccountNumber", tt.body)
+		if tt.want == "" {
+			if rec.Code != http.StatusOK {
+				t.Errorf("%s: status = %d, body %s", tt.name, rec.Code, rec.Body.String())
+			}
+			continue
+		}
+		if got := rec.Body.String(); rec.Code != http.StatusBadRequest || got != `{"errors":`+tt.want+`}` {
+			t.Errorf("%s: status = %d, body %s; want errors %s", tt.name, rec.Code, got, tt.want)
+		}
+	}
+
+	// Other actions keep the default validation, and only RequireJSON checks Content-Type
+	if rec := datadiptest.Do(h, "POST", "/GetContactByPhoneNumber", `{"PhoneNumber":"+60327763333","Extra":1}`); rec.Code != http.StatusOK {
+		t.Errorf("other action: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	h = datadip.NewHandler(datadiptest.NewStore(), datadip.WithValidation(datadip.ActionGetContactByPhoneNumber, datadip.Validation{RequireJSON: true}))
+	var req = httptest.NewRequest("POST", "/GetContactByPhoneNumber", strings.NewReader(`{"PhoneNumber":"+60327763333"}`))
+	req.Header.Set("Content-Type", "text/plain")
+	var rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `"field":"Content-Type"`) {
+		t.Errorf("wrong Content-Type: status = %d, body %s", rec.Code, rec.Body.String())
+	}
+	if rec = datadiptest.Do(h, "POST", "/GetContactByPhoneNumber", `{"PhoneNumber":"+60327763333"}`); rec.Code != http.StatusOK {
+		t.Errorf("application/json: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestPreviewHandler(t *testing.T) {
+	var h = datadip.PreviewHandler(datadip.NewHandler(datadiptest.NewStore()))
+
+	var rec = datadiptest.Do(h, "POST", "/debug/metadata/GetAccountByAccountNumber", `{"AccountNumber":"123"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var preview struct {
+		Status   int
+		Metadata datadip.Metadata
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &preview); err != nil {
+		t.Fatal(err)
+	}
+	if preview.Status != http.StatusOK {
+		t.Errorf("action status = %d, want %d", preview.Status, http.StatusOK)
+	}
+	if v := preview.Metadata.Values["Account.EmailAddresses.EmailAddress[0].EmailAddress"]; v != "szemin.ng@inin.com" {
+		t.Errorf("flattened email address = %v", v)
+	}
+	var unset = strings.Join(preview.Metadata.NotSet, " ")
+	if !strings.Contains(unset, "Account.PhoneNumbers.PhoneNumber[0].Number") || strings.Contains(unset, "Account.Name") {
+		t.Errorf("notSet = %v", preview.Metadata.NotSet)
+	}
+
+	if rec = datadiptest.Do(h, "POST", "/debug/metadata/GetAccountByContactId", `{}`); rec.Code != http.StatusNotFound {
+		t.Errorf("unimplemented action: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
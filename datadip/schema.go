@@ -0,0 +1,87 @@
+package datadip
+
+import (
+	"reflect"
+	"strings"
+)
+
+// JSONSchema returns a JSON Schema describing values of the type of v as encoding/json writes them. Fields without
+// omitempty are required.
+func JSONSchema(v interface{}) map[string]interface{} {
+	var s = typeSchema(reflect.TypeOf(v))
+	s["$schema"] = "http://json-schema.org/draft-07/schema#"
+	return s
+}
+
+// typeSchema returns the JSON Schema for t.
+func typeSchema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		var properties = make(map[string]interface{})
+		var required []string
+		for _, f := range jsonFields(t) {
+			properties[f.name] = typeSchema(f.field.Type)
+			if !f.omitEmpty {
+				required = append(required, f.name)
+			}
+		}
+		var s = map[string]interface{}{"type": "object", "properties": properties, "additionalProperties": false}
+		if len(required) > 0 {
+			s["required"] = required
+		}
+		return s
+	}
+	return map[string]interface{}{}
+}
+
+// jsonField is a struct field as encoding/json sees it
+type jsonField struct {
+	name      string
+	omitEmpty bool
+	field     reflect.StructField
+}
+
+// jsonFields returns the exported fields of struct type t that encoding/json writes, in order, named as in JSON.
+func jsonFields(t reflect.Type) []jsonField {
+	var fields []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		var f = t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		var tag = f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		var parts = strings.Split(tag, ",")
+		var name = parts[0]
+		if name == "" {
+			name = f.Name
+		}
+		var omitEmpty bool
+		for _, opt := range parts[1:] {
+			if opt == "omitempty" {
+				omitEmpty = true
+			}
+		}
+		fields = append(fields, jsonField{name: name, omitEmpty: omitEmpty, field: f})
+	}
+	return fields
+}
@@ -0,0 +1,28 @@
+package datadip
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotFound is returned by a Store when no record matches the lookup key.
+var ErrNotFound = errors.New("record not found")
+
+// ErrUnavailable is returned by a Store instead of calling a backend that is known to be unhealthy. The Handler
+// answers it with the action's fallback response.
+var ErrUnavailable = errors.New("backend unavailable")
+
+// Store is a backend that answers the lookups made by PureCloud Web Services Data Dip Connector actions. Implementations
+// must be safe for concurrent use and should return ErrNotFound when no record matches.
+type Store interface {
+	GetAccountByAccountNumber(ctx context.Context, accountNumber string) (*Account, error)
+	GetContactByPhoneNumber(ctx context.Context, phoneNumber string) (*Contact, error)
+}
+
+// CaseStore is a Store that also finds a contact's most recent open case. The Handler answers the
+// GetMostRecentOpenCaseByContactId action only from stores that are CaseStores, and replies 501 Not Implemented from
+// others, so Stores written before the action was added keep working unchanged.
+type CaseStore interface {
+	Store
+	GetMostRecentOpenCaseByContactID(ctx context.Context, contactID string) (*Case, error)
+}
@@ -0,0 +1,181 @@
+package datadip
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultMaxBodySize is the largest request body, in bytes, an action accepts unless its Validation says otherwise
+const DefaultMaxBodySize = 64 << 10
+
+// Validation is how strictly an action checks its requests. Whatever the Validation, the fields of the action's
+// request type without omitempty, such as AccountNumber, are required and the body may be at most MaxBodySize bytes,
+// or DefaultMaxBodySize if MaxBodySize is 0.
+type Validation struct {
+	MaxBodySize int64
+	// RequireJSON refuses requests whose Content-Type is not application/json
+	RequireJSON bool
+	// DisallowUnknownFields refuses requests with fields the request type does not have
+	DisallowUnknownFields bool
+	// Fields holds format rules by request field name as in JSON, e.g. "PhoneNumber". Rules are not applied to
+	// fields left empty.
+	Fields map[string]FieldRule
+}
+
+// FieldRule constrains the format of a request field. Pattern, if set, must match the value; anchor it, e.g.
+// ^(?:[0-9]+)$, for it to match the whole value. MinLength and MaxLength count characters; a MaxLength of 0 means no
+// limit.
+type FieldRule struct {
+	Pattern   *regexp.Regexp
+	MinLength int
+	MaxLength int
+}
+
+// FieldError is a problem with one field of a request. Field is the field's name as in JSON, "Content-Type" for the
+// header, or "" for the body as a whole.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every problem found with a request. The Handler replies with it as JSON with 400 Bad Request.
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	var problems = make([]string, len(e))
+	for i, fe := range e {
+		if fe.Field == "" {
+			problems[i] = fe.Message
+		} else {
+			problems[i] = fe.Field + ": " + fe.Message
+		}
+	}
+	return "invalid request: " + strings.Join(problems, "; ")
+}
+
+// WithValidation checks the requests of action against v.
+func WithValidation(action string, v Validation) Option {
+	return func(h *Handler) {
+		h.validation[action] = v
+	}
+}
+
+// RequestFields returns the names of the fields of the action's request, as in JSON.
+func (a Action) RequestFields() []string {
+	var names []string
+	for _, f := range jsonFields(reflect.TypeOf(a.Request)) {
+		names = append(names, f.name)
+	}
+	return names
+}
+
+// maxBodySize returns the largest request body, in bytes, v accepts.
+func (v Validation) maxBodySize() int64 {
+	if v.MaxBodySize <= 0 {
+		return DefaultMaxBodySize
+	}
+	return v.MaxBodySize
+}
+
+// decode reads r's body into req, a pointer to a request struct, checking it against v. It returns a
+// ValidationError listing every problem found.
+func (v Validation) decode(r *http.Request, req interface{}) error {
+	if v.RequireJSON {
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+			return ValidationError{{Field: "Content-Type", Message: fmt.Sprintf("must be application/json, not %q", r.Header.Get("Content-Type"))}}
+		}
+	}
+
+	var max = v.maxBodySize()
+	var body, err = ioutil.ReadAll(io.LimitReader(r.Body, max+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(body)) > max {
+		return ValidationError{{Message: fmt.Sprintf("body must be at most %d bytes", max)}}
+	}
+
+	var dec = json.NewDecoder(bytes.NewReader(body))
+	if v.DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	if err = dec.Decode(req); err != nil {
+		return decodeError(err)
+	}
+
+	var problems ValidationError
+	var value = reflect.ValueOf(req).Elem()
+	for _, f := range jsonFields(value.Type()) {
+		var s = value.FieldByIndex(f.field.Index).String()
+		if s == "" {
+			if !f.omitEmpty {
+				problems = append(problems, FieldError{Field: f.name, Message: "is required"})
+			}
+			continue
+		}
+		var rule, ok = v.Fields[f.name]
+		if !ok {
+			continue
+		}
+		var n = utf8.RuneCountInString(s)
+		if n < rule.MinLength {
+			problems = append(problems, FieldError{Field: f.name, Message: fmt.Sprintf("must be at least %d characters", rule.MinLength)})
+		}
+		if rule.MaxLength > 0 && n > rule.MaxLength {
+			problems = append(problems, FieldError{Field: f.name, Message: fmt.Sprintf("must be at most %d characters", rule.MaxLength)})
+		}
+		if rule.Pattern != nil && !rule.Pattern.MatchString(s) {
+			problems = append(problems, FieldError{Field: f.name, Message: fmt.Sprintf("must match %s", rule.Pattern)})
+		}
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// decodeError describes err, returned by json.Decoder.Decode, as a ValidationError naming the field at fault where
+// there is one.
+func decodeError(err error) ValidationError {
+	if e, ok := err.(*json.UnmarshalTypeError); ok {
+		if e.Field == "" {
+			return ValidationError{{Message: "body must be a JSON object"}}
+		}
+		return ValidationError{{Field: e.Field, Message: fmt.Sprintf("must be a %s, not a %s", e.Type, e.Value)}}
+	}
+	// The decoder reports unknown fields as `json: unknown field "Name"`
+	if s := err.Error(); strings.HasPrefix(s, `json: unknown field "`) {
+		return ValidationError{{Field: strings.TrimSuffix(strings.TrimPrefix(s, `json: unknown field "`), `"`), Message: "is not a field of the request"}}
+	}
+	if err == io.EOF {
+		return ValidationError{{Message: "body must be a JSON object"}}
+	}
+	return ValidationError{{Message: "body is not valid JSON: " + err.Error()}}
+}
+
+// writeValidationError replies 400 Bad Request with the problems in err as JSON, or 500 Internal Server Error if the
+// request could not be read.
+func writeValidationError(w http.ResponseWriter, err error) {
+	var problems, ok = err.(ValidationError)
+	if !ok {
+		log.Printf("Failed to read request body: %s\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintln(w, err)
+		return
+	}
+	log.Printf("Refusing request: %s\n", problems)
+	var b, _ = json.Marshal(map[string]interface{}{"errors": problems})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write(b)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+
+	"purecloudwebservice/datadip"
+)
+
+// actionDescription describes one action as GET /actions lists it. Backend, BackendType, Timeout, Cache, Validation and
+// CustomAttribute are only set for implemented actions.
+type actionDescription struct {
+	Name        string            `json:"name"`
+	Method      string            `json:"method"`
+	Path        string            `json:"path"`
+	Implemented bool              `json:"implemented"`
+	KeyField    string            `json:"keyField"`
+	Backend     string            `json:"backend,omitempty"`
+	BackendType string            `json:"backendType,omitempty"`
+	Timeout     duration          `json:"timeout,omitempty"`
+	Cache       *cacheConfig      `json:"cache,omitempty"`
+	Validation  *validationConfig `json:"validation,omitempty"`
+	// CustomAttribute is the action's CustomAttribute template, if any
+	CustomAttribute string      `json:"customAttribute,omitempty"`
+	Request         interface{} `json:"request"`
+	Response        interface{} `json:"response"`
+}
+
+// describeActions returns a description of every action the router for cfg and d serves, in the order of
+// datadip.Actions.
+func describeActions(cfg *config, d *dataDip) []actionDescription {
+	var types = make(map[string]string)
+	for _, b := range cfg.Backends {
+		types[b.Name] = b.Type
+	}
+
+	var actions []actionDescription
+	for _, info := range datadip.Actions {
+		var a = actionDescription{
+			Name:        info.Name,
+			Method:      "POST",
+			Path:        "/" + info.Name,
+			Implemented: info.Implemented,
+			KeyField:    info.KeyField,
+			Request:     datadip.JSONSchema(info.Request),
+			Response:    datadip.JSONSchema(info.Response),
+		}
+		if info.Implemented {
+			var ac = cfg.Actions[info.Name]
+			a.Backend = cfg.Backend
+			if ac.Backend != "" {
+				a.Backend = ac.Backend
+			}
+			a.BackendType = types[a.Backend]
+			a.Timeout = duration(datadip.DefaultTimeout)
+			if rt, ok := d.routes[info.Name]; ok {
+				a.Timeout = duration(rt.timeout)
+			}
+			a.Cache = ac.Cache
+			a.Validation = ac.Validation
+			a.CustomAttribute = ac.CustomAttribute
+		}
+		actions = append(actions, a)
+	}
+	return actions
+}
+
+// discovery returns a handler for HTTP GETs to /actions, which lists every action the router for cfg and d serves:
+// whether it is implemented or a stub replying 501 Not Implemented, the JSON Schemas of its request and response, and
+// the backend, deadline and cache that answer it and the validation its requests get.
+func discovery(cfg *config, d *dataDip) http.Handler {
+	var actions = describeActions(cfg, d)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSONStatus(w, http.StatusOK, map[string]interface{}{"actions": actions})
+	})
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"purecloudwebservice/datadip"
+)
+
+// printExpressions runs the expressions subcommand with args, printing safe Architect expressions for every field
+// returned by each action named, or by every implemented action.
+func printExpressions(args []string) int {
+	var flags = flag.NewFlagSet("expressions", flag.ExitOnError)
+	var prefix = flags.String("prefix", "Flow.", "prefix of the flow variables the action's outputs are assigned to")
+	flags.Parse(args)
+
+	var names = flags.Args()
+	if len(names) == 0 {
+		for _, a := range datadip.Actions {
+			if a.Implemented {
+				names = append(names, a.Name)
+			}
+		}
+	}
+	for _, name := range names {
+		var info, ok = datadip.FindAction(name)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Unknown action %q\n", name)
+			return 2
+		}
+		if !info.Implemented {
+			fmt.Fprintf(os.Stderr, "Action %s is not implemented\n", name)
+			return 1
+		}
+		fmt.Printf("// ---- %s ----\n\n", name)
+		datadip.WriteExpressions(os.Stdout, info.Response, *prefix)
+	}
+	return 0
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"time"
+
+	"purecloudwebservice/datadip"
+)
+
+// failovers counts lookups answered by a secondary backend, by failover store name
+var failovers = expvar.NewMap("failovers")
+
+// failoverStore is a Store that sends lookups to a primary backend and falls back to a secondary backend, e.g. a read
+// replica, when the primary fails or times out.
+//
+// If primaryTimeout is set, the primary is given only that long so that there is time left to ask the secondary.
+// If hedgeDelay is set, the lookup is hedged: the secondary is asked as well once the primary has not answered within
+// hedgeDelay, and whichever answers first wins. A backend answers when it finds the record or returns ErrNotFound.
+type failoverStore struct {
+	name           string
+	primary        datadip.CaseStore
+	secondary      datadip.CaseStore
+	primaryTimeout time.Duration
+	hedgeDelay     time.Duration
+}
+
+// newFailoverStore returns a Store that fails over from primary to secondary, counting failovers under name.
+func newFailoverStore(name string, primary, secondary datadip.CaseStore, primaryTimeout, hedgeDelay time.Duration) *failoverStore {
+	return &failoverStore{name: name, primary: primary, secondary: secondary, primaryTimeout: primaryTimeout, hedgeDelay: hedgeDelay}
+}
+
+// GetAccountByAccountNumber looks up an account in the primary, failing over to the secondary.
+func (s *failoverStore) GetAccountByAccountNumber(ctx context.Context, accountNumber string) (*datadip.Account, error) {
+	var v, err = s.do(ctx, func(ctx context.Context, backend datadip.CaseStore) (interface{}, error) {
+		return backend.GetAccountByAccountNumber(ctx, accountNumber)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*datadip.Account), nil
+}
+
+// GetContactByPhoneNumber looks up a contact in the primary, failing over to the secondary.
+func (s *failoverStore) GetContactByPhoneNumber(ctx context.Context, phoneNumber string) (*datadip.Contact, error) {
+	var v, err = s.do(ctx, func(ctx context.Context, backend datadip.CaseStore) (interface{}, error) {
+		return backend.GetContactByPhoneNumber(ctx, phoneNumber)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*datadip.Contact), nil
+}
+
+// GetMostRecentOpenCaseByContactID looks up a case in the primary, failing over to the secondary.
+func (s *failoverStore) GetMostRecentOpenCaseByContactID(ctx context.Context, contactID string) (*datadip.Case, error) {
+	var v, err = s.do(ctx, func(ctx context.Context, backend datadip.CaseStore) (interface{}, error) {
+		return backend.GetMostRecentOpenCaseByContactID(ctx, contactID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*datadip.Case), nil
+}
+
+// failoverResult is what the primary or secondary answered
+type failoverResult struct {
+	secondary bool
+	val       interface{}
+	err       error
+}
+
+// answered reports whether the backend gave an answer, as opposed to failing.
+func (r failoverResult) answered() bool {
+	return r.err == nil || r.err == datadip.ErrNotFound
+}
+
+// do runs lookup against the primary and, when needed, the secondary, returning the first answer.
+func (s *failoverStore) do(ctx context.Context, lookup func(context.Context, datadip.CaseStore) (interface{}, error)) (interface{}, error) {
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithCancel(ctx)
+	defer cancel()
+
+	var results = make(chan failoverResult, 2)
+	go func() {
+		var primaryCtx = ctx
+		if s.primaryTimeout > 0 {
+			var cancel context.CancelFunc
+			primaryCtx, cancel = context.WithTimeout(ctx, s.primaryTimeout)
+			defer cancel()
+		}
+		var v, err = lookup(primaryCtx, s.primary)
+		results <- failoverResult{val: v, err: err}
+	}()
+	var askSecondary = func() {
+		go func() {
+			var v, err = lookup(ctx, s.secondary)
+			results <- failoverResult{secondary: true, val: v, err: err}
+		}()
+	}
+
+	var hedge <-chan time.Time
+	if s.hedgeDelay > 0 {
+		var timer = time.NewTimer(s.hedgeDelay)
+		defer timer.Stop()
+		hedge = timer.C
+	}
+
+	// Wait for the first answer. The secondary is asked once the primary fails, or once the hedge delay passes
+	var asked, pending = 1, 1
+	var last failoverResult
+	for pending > 0 {
+		select {
+		case res := <-results:
+			pending--
+			if res.answered() {
+				if res.secondary {
+					failovers.Add(s.name, 1)
+				}
+				return res.val, res.err
+			}
+			last = res
+			if asked == 1 && ctx.Err() == nil {
+				asked++
+				pending++
+				askSecondary()
+			}
+		case <-hedge:
+			if asked == 1 {
+				asked++
+				pending++
+				askSecondary()
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return nil, last.err
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"purecloudwebservice/datadip"
+	"purecloudwebservice/datadip/datadiptest"
+)
+
+func TestFailoverStore(t *testing.T) {
+	var crmDown = errors.New("crm down")
+	var store = func(name string, delay time.Duration, err error) *datadiptest.Store {
+		return &datadiptest.Store{Accounts: map[string]*datadip.Account{"123": {Name: name}}, Delay: delay, Err: err}
+	}
+
+	var tests = []struct {
+		name           string
+		primary        *datadiptest.Store
+		secondary      *datadiptest.Store
+		primaryTimeout time.Duration
+		hedgeDelay     time.Duration
+		want           string
+		err            error
+		secondaryCalls int
+	}{
+		{"primary answers", store("primary", 0, nil), store("secondary", 0, nil), 0, 0, "primary", nil, 0},
+		{"primary not found is an answer", store("primary", 0, datadip.ErrNotFound), store("secondary", 0, nil), 0, 0, "", datadip.ErrNotFound, 0},
+		{"primary fails", store("primary", 0, crmDown), store("secondary", 0, nil), 0, 0, "secondary", nil, 1},
+		{"primary times out", store("primary", time.Second, nil), store("secondary", 0, nil), 20 * time.Millisecond, 0, "secondary", nil, 1},
+		{"both fail", store("primary", 0, crmDown), store("secondary", 0, errors.New("replica down")), 0, 0, "", errors.New("replica down"), 1},
+		{"hedged, secondary answers first", store("primary", time.Second, nil), store("secondary", 0, nil), 0, 20 * time.Millisecond, "secondary", nil, 1},
+		{"hedged, primary answers before the hedge", store("primary", 0, nil), store("secondary", 0, nil), 0, 200 * time.Millisecond, "primary", nil, 0},
+		{"hedged, primary answers first", store("primary", 50*time.Millisecond, nil), store("secondary", time.Second, nil), 0, 10 * time.Millisecond, "primary", nil, 1},
+	}
+	for _, tt := range tests {
+		var before = expvarInt(failovers, tt.name)
+		var s = newFailoverStore(tt.name, tt.primary, tt.secondary, tt.primaryTimeout, tt.hedgeDelay)
+		var start = time.Now()
+		var a, err = s.GetAccountByAccountNumber(context.Background(), "123")
+		if (err == nil) != (tt.err == nil) || (err != nil && err.Error() != tt.err.Error()) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if time.Since(start) > 500*time.Millisecond {
+			t.Errorf("%s: took %s", tt.name, time.Since(start))
+		}
+		if err == nil && a.Name != tt.want {
+			t.Errorf("%s: answered by %s, want %s", tt.name, a.Name, tt.want)
+		}
+		if n := tt.secondary.Calls(); n != tt.secondaryCalls {
+			t.Errorf("%s: secondary calls = %d, want %d", tt.name, n, tt.secondaryCalls)
+		}
+		var failedOver int64
+		if tt.want == "secondary" {
+			failedOver = 1
+		}
+		if n := expvarInt(failovers, tt.name) - before; n != failedOver {
+			t.Errorf("%s: failovers = %d, want %d", tt.name, n, failedOver)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+
+	"purecloudwebservice/datadip"
+)
+
+// storeFile is the layout of the JSON file read by fileStore
+type storeFile struct {
+	Accounts []datadip.Account `json:"Accounts,omitempty"`
+	Contacts []datadip.Contact `json:"Contacts,omitempty"`
+	Cases    []datadip.Case    `json:"Cases,omitempty"`
+}
+
+// storeFileRecords holds the record type of each list in a storeFile, by the list's name in JSON
+var storeFileRecords = map[string]reflect.Type{
+	"Accounts": reflect.TypeOf(datadip.Account{}),
+	"Contacts": reflect.TypeOf(datadip.Contact{}),
+	"Cases":    reflect.TypeOf(datadip.Case{}),
+}
+
+// fieldMappings lets a file backend keep records whose fields are not named as in the responses. It maps each list in
+// the file, "Accounts", "Contacts" or "Cases", to the names its records use for fields and the response field each
+// one holds, e.g. {"Accounts": {"acct_no": "Number", "display_name": "Name"}}. Fields not mapped keep their names.
+type fieldMappings map[string]map[string]string
+
+// rename renames the fields of the records in b, a store file, from the file's names to the response names, or back
+// again if reverse is set.
+func (m fieldMappings) rename(b []byte, reverse bool) ([]byte, error) {
+	var file map[string][]map[string]json.RawMessage
+	if err := json.Unmarshal(b, &file); err != nil {
+		return nil, err
+	}
+	for list, records := range file {
+		var names = m[list]
+		if reverse {
+			names = make(map[string]string, len(m[list]))
+			for from, to := range m[list] {
+				names[to] = from
+			}
+		}
+		for i, r := range records {
+			var renamed = make(map[string]json.RawMessage, len(r))
+			for k, v := range r {
+				if to, ok := names[k]; ok {
+					k = to
+				}
+				renamed[k] = v
+			}
+			records[i] = renamed
+		}
+	}
+	return json.Marshal(file)
+}
+
+// fileStore is a Store that answers lookups from accounts, contacts and cases read from a JSON file. Accounts are found
+// by Number and contacts by any of their phone numbers. A contact's most recent open case is the one with its ContactId
+// and the latest CreatedDate, compared as text, whose Status is not "Closed".
+type fileStore struct {
+	path     string
+	mappings fieldMappings
+
+	mu       sync.RWMutex
+	data     *storeFile
+	accounts map[string]*datadip.Account
+	contacts map[string]*datadip.Contact
+	cases    map[string]*datadip.Case
+}
+
+// newFileStore reads the records in the JSON file at path, whose fields are named as mappings says.
+func newFileStore(path string, mappings fieldMappings) (*fileStore, error) {
+	var data, err = readStoreFile(path, mappings)
+	if err != nil {
+		return nil, err
+	}
+
+	var s = &fileStore{path: path, mappings: mappings}
+	s.index(data)
+	return s, nil
+}
+
+// index makes data the records lookups are answered from. s.mu must be held, unless s is not in use yet.
+func (s *fileStore) index(data *storeFile) {
+	s.data = data
+	s.accounts = make(map[string]*datadip.Account, len(data.Accounts))
+	s.contacts = make(map[string]*datadip.Contact, len(data.Contacts))
+	s.cases = make(map[string]*datadip.Case)
+	for i := range data.Accounts {
+		s.accounts[data.Accounts[i].Number] = &data.Accounts[i]
+	}
+	for i := range data.Contacts {
+		var c = &data.Contacts[i]
+		if c.PhoneNumbers != nil {
+			for _, p := range c.PhoneNumbers.PhoneNumbers {
+				s.contacts[normalizePhoneNumber(p.Number)] = c
+			}
+		}
+	}
+	for i := range data.Cases {
+		var c = &data.Cases[i]
+		if c.ContactID == "" || strings.EqualFold(c.Status, "Closed") {
+			continue
+		}
+		if latest, ok := s.cases[c.ContactID]; !ok || c.CreatedDate > latest.CreatedDate {
+			s.cases[c.ContactID] = c
+		}
+	}
+}
+
+// reread reads the file again, e.g. after it was edited by hand. Lookups keep being answered from the records in s
+// until the ones returned are passed to replace.
+func (s *fileStore) reread() (*storeFile, error) {
+	return readStoreFile(s.path, s.mappings)
+}
+
+// replace makes data, read by reread, the records lookups are answered from.
+func (s *fileStore) replace(data *storeFile) {
+	s.mu.Lock()
+	s.index(data)
+	s.mu.Unlock()
+}
+
+// snapshot returns the records in s. They must not be modified.
+func (s *fileStore) snapshot() *storeFile {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data
+}
+
+// update calls fn with a copy of the records in s and, if it succeeds, writes the copy back to the file and answers
+// lookups from it. Records already returned by lookups are left as they were.
+func (s *fileStore) update(fn func(data *storeFile) error) error {
+	var err error
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var data = &storeFile{
+		Accounts: append([]datadip.Account(nil), s.data.Accounts...),
+		Contacts: append([]datadip.Contact(nil), s.data.Contacts...),
+		Cases:    append([]datadip.Case(nil), s.data.Cases...),
+	}
+	if err = fn(data); err != nil {
+		return err
+	}
+	if err = writeStoreFile(s.path, data, s.mappings); err != nil {
+		return err
+	}
+	s.index(data)
+	return nil
+}
+
+// GetAccountByAccountNumber returns the account with the given number.
+func (s *fileStore) GetAccountByAccountNumber(ctx context.Context, accountNumber string) (*datadip.Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var account, ok = s.accounts[accountNumber]
+	if !ok {
+		return nil, datadip.ErrNotFound
+	}
+	return account, nil
+}
+
+// GetContactByPhoneNumber returns the contact with the given phone number, ignoring formatting.
+func (s *fileStore) GetContactByPhoneNumber(ctx context.Context, phoneNumber string) (*datadip.Contact, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var contact, ok = s.contacts[normalizePhoneNumber(phoneNumber)]
+	if !ok {
+		return nil, datadip.ErrNotFound
+	}
+	return contact, nil
+}
+
+// GetMostRecentOpenCaseByContactID returns the most recent open case of the contact with the given id.
+func (s *fileStore) GetMostRecentOpenCaseByContactID(ctx context.Context, contactID string) (*datadip.Case, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var c, ok = s.cases[contactID]
+	if !ok {
+		return nil, datadip.ErrNotFound
+	}
+	return c, nil
+}
+
+// normalizePhoneNumber strips everything but digits and a plus sign from a phone number, so that "+60 3-2776 3333"
+// and "+60327763333" compare equal.
+func normalizePhoneNumber(number string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= '0' && r <= '9') || r == '+' {
+			return r
+		}
+		return -1
+	}, number)
+}
+
+// readStoreFile reads the records in the JSON file at path, whose fields are named as mappings says.
+func readStoreFile(path string, mappings fieldMappings) (*storeFile, error) {
+	var err error
+
+	var b []byte
+	if b, err = ioutil.ReadFile(path); err != nil {
+		return nil, err
+	}
+	if len(mappings) > 0 {
+		if b, err = mappings.rename(b, false); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %s", path, err)
+		}
+	}
+
+	var data storeFile
+	if err = json.NewDecoder(bytes.NewReader(b)).Decode(&data); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %s", path, err)
+	}
+	return &data, nil
+}
+
+// writeStoreFile replaces the JSON file at path with data, naming fields as mappings says. The file is written in full
+// before it replaces the old one, so a running service never reads half a file.
+func writeStoreFile(path string, data *storeFile, mappings fieldMappings) error {
+	var err error
+
+	var b []byte
+	if b, err = json.MarshalIndent(data, "", "  "); err != nil {
+		return err
+	}
+	if len(mappings) > 0 {
+		var indented bytes.Buffer
+		if b, err = mappings.rename(b, true); err == nil {
+			err = json.Indent(&indented, b, "", "  ")
+		}
+		if err != nil {
+			return err
+		}
+		b = indented.Bytes()
+	}
+	var tmp = path + ".tmp"
+	if err = ioutil.WriteFile(tmp, append(b, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// merge adds the accounts, contacts and cases in other to data. An account replaces the one with the same Number and a
+// contact or case the one with the same Id. It returns how many accounts, contacts and cases were added or replaced.
+func (data *storeFile) merge(other *storeFile) (int, int, int) {
+	for _, a := range other.Accounts {
+		var replaced bool
+		for i := range data.Accounts {
+			if data.Accounts[i].Number == a.Number {
+				data.Accounts[i], replaced = a, true
+				break
+			}
+		}
+		if !replaced {
+			data.Accounts = append(data.Accounts, a)
+		}
+	}
+	for _, c := range other.Contacts {
+		var replaced bool
+		for i := range data.Contacts {
+			if c.ID != "" && data.Contacts[i].ID == c.ID {
+				data.Contacts[i], replaced = c, true
+				break
+			}
+		}
+		if !replaced {
+			data.Contacts = append(data.Contacts, c)
+		}
+	}
+	for _, c := range other.Cases {
+		var replaced bool
+		for i := range data.Cases {
+			if c.ID != "" && data.Cases[i].ID == c.ID {
+				data.Cases[i], replaced = c, true
+				break
+			}
+		}
+		if !replaced {
+			data.Cases = append(data.Cases, c)
+		}
+	}
+	return len(other.Accounts), len(other.Contacts), len(other.Cases)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"purecloudwebservice/datadip"
+)
+
+func TestFileStore(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "filestore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var path = filepath.Join(dir, "records.json")
+	if err = ioutil.WriteFile(path, []byte(`{
+		"Accounts": [{"Id": "1", "Name": "Ng Sze Min", "Number": "123"}],
+		"Contacts": [{"Id": "2", "FullName": "Ng Sze Min", "PhoneNumbers": {"PhoneNumber": [{"Number": "+60 3-2776 3333", "PhoneType": 1}]}}],
+		"Cases": [
+			{"Id": "5", "ContactId": "2", "Status": "New", "CreatedDate": "2017-03-01T09:00:00Z"},
+			{"Id": "6", "ContactId": "2", "Status": "Working", "CreatedDate": "2017-03-02T09:00:00Z"},
+			{"Id": "7", "ContactId": "2", "Status": "Closed", "CreatedDate": "2017-03-03T09:00:00Z"},
+			{"Id": "8", "ContactId": "9", "Status": "Closed", "CreatedDate": "2017-03-01T09:00:00Z"}
+		]
+	}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var s *fileStore
+	if s, err = newFileStore(path, nil); err != nil {
+		t.Fatal(err)
+	}
+	var ctx = context.Background()
+
+	var tests = []struct {
+		name   string
+		action string
+		key    string
+		want   string
+		err    error
+	}{
+		{"account", datadip.ActionGetAccountByAccountNumber, "123", "1", nil},
+		{"unknown account", datadip.ActionGetAccountByAccountNumber, "999", "", datadip.ErrNotFound},
+		{"contact formatted differently", datadip.ActionGetContactByPhoneNumber, "+60327763333", "2", nil},
+		{"unknown contact", datadip.ActionGetContactByPhoneNumber, "+1", "", datadip.ErrNotFound},
+		{"latest open case", datadip.ActionGetMostRecentOpenCaseByContactID, "2", "6", nil},
+		{"only closed cases", datadip.ActionGetMostRecentOpenCaseByContactID, "9", "", datadip.ErrNotFound},
+	}
+	for _, tt := range tests {
+		var got string
+		switch tt.action {
+		case datadip.ActionGetAccountByAccountNumber:
+			var a *datadip.Account
+			if a, err = s.GetAccountByAccountNumber(ctx, tt.key); a != nil {
+				got = a.ID
+			}
+		case datadip.ActionGetContactByPhoneNumber:
+			var c *datadip.Contact
+			if c, err = s.GetContactByPhoneNumber(ctx, tt.key); c != nil {
+				got = c.ID
+			}
+		case datadip.ActionGetMostRecentOpenCaseByContactID:
+			var c *datadip.Case
+			if c, err = s.GetMostRecentOpenCaseByContactID(ctx, tt.key); c != nil {
+				got = c.ID
+			}
+		}
+		if got != tt.want || err != tt.err {
+			t.Errorf("%s: Id = %q, err = %v; want %q, %v", tt.name, got, err, tt.want, tt.err)
+		}
+	}
+
+	// Updates are written to the file and answer lookups straight away
+	var before, _ = s.GetAccountByAccountNumber(ctx, "123")
+	if err = s.update(func(data *storeFile) error {
+		data.merge(&storeFile{Accounts: []datadip.Account{{ID: "3", Number: "123", Name: "Replaced"}, {ID: "4", Number: "456"}}})
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if a, _ := s.GetAccountByAccountNumber(ctx, "123"); a == nil || a.Name != "Replaced" {
+		t.Errorf("replaced account = %+v", a)
+	}
+	if before.Name != "Ng Sze Min" {
+		t.Errorf("account returned before the update changed to %+v", before)
+	}
+	var data *storeFile
+	if data, err = readStoreFile(path, nil); err != nil || len(data.Accounts) != 2 || len(data.Contacts) != 1 {
+		t.Errorf("file = %+v, %v", data, err)
+	}
+}
+
+func TestFileStoreFieldMappings(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "filestore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var path = filepath.Join(dir, "records.json")
+	if err = ioutil.WriteFile(path, []byte(`{"Accounts": [{"acct_no": "123", "display_name": "Ng Sze Min", "Id": "1"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var mappings = fieldMappings{"Accounts": {"acct_no": "Number", "display_name": "Name"}}
+	var s *fileStore
+	if s, err = newFileStore(path, mappings); err != nil {
+		t.Fatal(err)
+	}
+	if a, err := s.GetAccountByAccountNumber(context.Background(), "123"); err != nil || a.Name != "Ng Sze Min" || a.ID != "1" {
+		t.Errorf("mapped account = %+v, %v", a, err)
+	}
+
+	// Updates are written back with the file's names
+	if err = s.update(func(data *storeFile) error {
+		data.Accounts = append(data.Accounts, datadip.Account{Number: "456", Name: "Added"})
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var b, _ = ioutil.ReadFile(path)
+	var file map[string][]map[string]string
+	if err = json.Unmarshal(b, &file); err != nil || len(file["Accounts"]) != 2 || file["Accounts"][1]["acct_no"] != "456" || file["Accounts"][1]["display_name"] != "Added" {
+		t.Errorf("file = %s", b)
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// readyz handles HTTP GETs to /readyz. It replies 200 OK when every backend lookups are answered from can take them,
+// or 503 Service Unavailable naming the backends whose circuit breaker is open. Backends that only take shadow lookups
+// do not count.
+func readyz(w http.ResponseWriter, r *http.Request) {
+	var open = openBreakers()
+	if len(open) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "circuit breaker open: %s\n", strings.Join(open, ", "))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "ready")
+}
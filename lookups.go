@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"purecloudwebservice/datadip"
+)
+
+// defaultRecentLookups is how many lookups are kept for the admin console unless the configuration says otherwise
+const defaultRecentLookups = 100
+
+// recentLookups holds the latest data dip requests answered, newest last, and feeds the live tail. It outlives
+// configuration reloads.
+var recentLookups = &lookupLog{limit: defaultRecentLookups}
+
+// lookupRecord is one data dip request and the reply sent. Caller is the HTTP Basic username the request was sent
+// with, if any.
+type lookupRecord struct {
+	Time     time.Time `json:"time"`
+	Caller   string    `json:"caller,omitempty"`
+	Action   string    `json:"action"`
+	Request  string    `json:"request"`
+	Status   int       `json:"status"`
+	Response string    `json:"response"`
+	Latency  duration  `json:"latency"`
+}
+
+// lookupLog keeps the latest lookups, up to limit, and passes each lookup on to its subscribers as it is added
+type lookupLog struct {
+	mu          sync.Mutex
+	limit       int
+	records     []lookupRecord
+	subscribers map[chan lookupRecord]bool
+}
+
+// add appends r, dropping the oldest lookup if the log is full, and sends it to every subscriber that is keeping up.
+func (l *lookupLog) add(r lookupRecord) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records = append(l.records, r)
+	if len(l.records) > l.limit {
+		l.records = append([]lookupRecord(nil), l.records[len(l.records)-l.limit:]...)
+	}
+	for ch := range l.subscribers {
+		select {
+		case ch <- r:
+		default:
+		}
+	}
+}
+
+// subscribe returns a channel that receives every lookup added from now on, and a function that unsubscribes. If
+// the channel is not drained fast enough, lookups are dropped rather than holding up the actions.
+func (l *lookupLog) subscribe() (<-chan lookupRecord, func()) {
+	var ch = make(chan lookupRecord, 64)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.subscribers == nil {
+		l.subscribers = make(map[chan lookupRecord]bool)
+	}
+	l.subscribers[ch] = true
+	return ch, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.subscribers, ch)
+	}
+}
+
+// recent returns the lookups kept, newest first.
+func (l *lookupLog) recent() []lookupRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var records = make([]lookupRecord, len(l.records))
+	for i, r := range l.records {
+		records[len(records)-1-i] = r
+	}
+	return records
+}
+
+// setLimit changes how many lookups are kept, dropping the oldest if there are more.
+func (l *lookupLog) setLimit(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+	if len(l.records) > limit {
+		l.records = append([]lookupRecord(nil), l.records[len(l.records)-limit:]...)
+	}
+}
+
+// key returns the lookup key sent in r's request, or "" if there is none.
+func (r lookupRecord) key() string {
+	var info, ok = datadip.FindAction(r.Action)
+	if !ok {
+		return ""
+	}
+	var req map[string]interface{}
+	json.Unmarshal([]byte(r.Request), &req)
+	var key, _ = req[info.KeyField].(string)
+	return key
+}
+
+// result describes the outcome of r in a word or two: found, fallback, not found, bad request, not implemented or
+// error.
+func (r lookupRecord) result() string {
+	switch r.Status {
+	case http.StatusOK:
+		// A fallback reply holds a single empty record, e.g. {"Account":{}}
+		var resp map[string]map[string]interface{}
+		if json.Unmarshal([]byte(r.Response), &resp) == nil && len(resp) == 1 {
+			for _, record := range resp {
+				if len(record) == 0 {
+					return "fallback"
+				}
+			}
+		}
+		return "found"
+	case http.StatusNotFound:
+		return "not found"
+	case http.StatusBadRequest:
+		return "bad request"
+	case http.StatusNotImplemented:
+		return "not implemented"
+	}
+	return "error"
+}
+
+// recordID returns the Id of the record found by r, or "" if none was found.
+func (r lookupRecord) recordID() string {
+	if r.Status != http.StatusOK {
+		return ""
+	}
+	var resp map[string]map[string]interface{}
+	json.Unmarshal([]byte(r.Response), &resp)
+	for _, record := range resp {
+		var id, _ = record["Id"].(string)
+		return id
+	}
+	return ""
+}
+
+// recordLookups returns a Middleware that passes every request an action answers, with its reply and how long it
+// took, to each of record in turn. They are called after the reply has been written, so the caller may already have it.
+func recordLookups(record ...func(lookupRecord)) datadip.Middleware {
+	return func(action string, next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body, _ = ioutil.ReadAll(r.Body)
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			var rec = &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+			var start = time.Now()
+			next.ServeHTTP(rec, r)
+			var caller, _, _ = r.BasicAuth()
+			var lookup = lookupRecord{
+				Time:     start,
+				Caller:   caller,
+				Action:   action,
+				Request:  string(body),
+				Status:   rec.status,
+				Response: rec.body.String(),
+				Latency:  duration(time.Since(start)),
+			}
+			for _, fn := range record {
+				fn(lookup)
+			}
+		})
+	}
+}
+
+// recordingWriter is an http.ResponseWriter that keeps a copy of the status and body written
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// actionRequest returns a request sending body to action as JSON, as the connector would, for running through the
+// actions in-process with ctx.
+func actionRequest(ctx context.Context, action string, body []byte) *http.Request {
+	var req, err = http.NewRequest("POST", "/"+action, bytes.NewReader(body))
+	if err != nil {
+		panic(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req.WithContext(ctx)
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"purecloudwebservice/datadip"
+	"purecloudwebservice/datadip/datadiptest"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+// newTestRouter returns the router main serves, with every implemented action answered by store within timeout.
+func newTestRouter(cfg *config, store datadip.CaseStore, timeout time.Duration) http.Handler {
+	return newRouter(cfg, newTestDataDip(store, timeout))
+}
+
+// newTestDataDip returns a dataDip with every implemented action answered by store within timeout, for tests that
+// add to it before routing to it with newRouter.
+func newTestDataDip(store datadip.CaseStore, timeout time.Duration) *dataDip {
+	var d = &dataDip{store: store, routes: make(map[string]route)}
+	for _, a := range datadip.Actions {
+		if a.Implemented {
+			d.routes[a.Name] = route{store: store, timeout: timeout}
+		}
+	}
+	return d
+}
+
+// captureStdout runs fn and returns what it printed to standard output.
+func captureStdout(t *testing.T, fn func()) string {
+	var r, w, err = os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout = os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	var out = make(chan []byte)
+	go func() {
+		var b, _ = ioutil.ReadAll(r)
+		out <- b
+	}()
+	fn()
+	w.Close()
+	return string(<-out)
+}
+
+// expvarInt returns the counter key in m, or 0 if nothing has been counted under key yet.
+func expvarInt(m *expvar.Map, key string) int64 {
+	if v, ok := m.Get(key).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func TestActionsRequireAuth(t *testing.T) {
+	var cfg = &config{Auth: &authConfig{Users: []userConfig{{Username: "purecloud", Password: "secret"}}}}
+	var h = newTestRouter(cfg, datadiptest.NewStore(), time.Second)
+
+	var tests = []struct {
+		name     string
+		username string
+		password string
+		status   int
+	}{
+		{"no credentials", "", "", http.StatusUnauthorized},
+		{"wrong password", "purecloud", "guess", http.StatusUnauthorized},
+		{"unknown user", "someone", "secret", http.StatusUnauthorized},
+		{"valid credentials", "purecloud", "secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req = httptest.NewRequest("POST", "/GetAccountByAccountNumber", strings.NewReader(`{"AccountNumber":"123"}`))
+			if tt.username != "" {
+				req.SetBasicAuth(tt.username, tt.password)
+			}
+			var rec = httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if tt.status == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("missing WWW-Authenticate header")
+			}
+		})
+	}
+
+	// Readiness checks are not authenticated
+	if rec := datadiptest.Do(h, "GET", "/readyz", ""); rec.Code != http.StatusOK {
+		t.Errorf("/readyz status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	defer setBreakers(nil, nil)
+	var h = newTestRouter(new(config), datadiptest.NewStore(), time.Second)
+
+	var b = newCircuitBreaker(breakerSettings{FailureThreshold: 1, OpenTimeout: time.Minute})
+	setBreakers(map[string]*circuitBreaker{"crm": b}, nil)
+	if rec := datadiptest.Do(h, "GET", "/readyz", ""); rec.Code != http.StatusOK {
+		t.Fatalf("closed breaker: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var ticket, _ = b.allow()
+	b.record(ticket, true)
+	var rec = datadiptest.Do(h, "GET", "/readyz", "")
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "crm") {
+		t.Fatalf("open breaker: status = %d, body %q; want %d naming crm", rec.Code, rec.Body.String(), http.StatusServiceUnavailable)
+	}
+}
+
+func TestReadyzShadow(t *testing.T) {
+	defer setBreakers(nil, nil)
+	var cfg = &config{
+		Backend: "migrating",
+		Backends: []backendConfig{
+			{Name: "crm", Type: backendSample},
+			{Name: "new-crm", Type: backendSample},
+			{Name: "new-billing", Type: backendSample},
+			{Name: "new", Type: backendComposite, Members: []string{"new-crm", "new-billing"}},
+			{Name: "migrating", Type: backendShadow, Primary: "crm", Shadow: "new"},
+		},
+		Actions: map[string]actionConfig{"GetContactByPhoneNumber": {Backend: "new-billing"}},
+	}
+	cfg.applyDefaults()
+	if problems := cfg.validate(); len(problems) > 0 {
+		t.Fatal(problems)
+	}
+	var d, err = newDataDip(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var h = newRouter(cfg, d)
+	setBreakers(d.breakers, d.shadowOnly)
+	var trip = func(b *circuitBreaker) {
+		for i := 0; i < defaultBreakerSettings.FailureThreshold; i++ {
+			var ticket, _ = b.allow()
+			b.record(ticket, true)
+		}
+	}
+
+	// Breakers are tripped one after the other
+	var tests = []struct {
+		name    string
+		backend string
+		status  int
+		want    string
+	}{
+		{"shadow only", "new-crm", http.StatusOK, "ready\n"},
+		{"shadow that also answers an action", "new-billing", http.StatusServiceUnavailable, "circuit breaker open: new-billing\n"},
+		{"primary", "crm", http.StatusServiceUnavailable, "circuit breaker open: crm, new-billing\n"},
+	}
+	for _, tt := range tests {
+		trip(d.breakers[tt.backend])
+		if rec := datadiptest.Do(h, "GET", "/readyz", ""); rec.Code != tt.status || rec.Body.String() != tt.want {
+			t.Errorf("%s: status = %d, body %q; want %d, %q", tt.name, rec.Code, rec.Body.String(), tt.status, tt.want)
+		}
+	}
+}
+
+func TestDebugMetadata(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var path = filepath.Join(dir, "traffic.jsonl")
+	defer recentLookups.setLimit(defaultRecentLookups)
+	recentLookups.setLimit(0)
+	recentLookups.setLimit(defaultRecentLookups)
+
+	var d = newTestDataDip(datadiptest.NewStore(), time.Second)
+	if d.recorder, err = openTrafficRecorder(path); err != nil {
+		t.Fatal(err)
+	}
+	var h = newRouter(new(config), d)
+
+	var rec = datadiptest.Do(h, "POST", "/debug/metadata/GetAccountByAccountNumber", `{"AccountNumber":"123"}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Account.Number") {
+		t.Fatalf("status = %d, body %q; want %d with flattened fields", rec.Code, rec.Body.String(), http.StatusOK)
+	}
+	// Previews are not the connector's lookups, so they are neither kept for the console and live tail nor recorded
+	if n := len(recentLookups.recent()); n != 0 {
+		t.Errorf("%d lookups kept after a preview, want 0", n)
+	}
+	if data, _ := ioutil.ReadFile(path); len(data) != 0 {
+		t.Errorf("preview recorded:\n%s", data)
+	}
+	if rec = datadiptest.Do(h, "POST", "/debug/metadata/GetAccountByContactId", `{}`); rec.Code != http.StatusNotFound {
+		t.Errorf("unimplemented action: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestDebugVars(t *testing.T) {
+	var h = newTestRouter(new(config), datadiptest.NewStore(), time.Second)
+
+	var rec = datadiptest.Do(h, "GET", "/debug/vars", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var vars map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &vars); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"breakers", "bulkheads", "retries"} {
+		if _, ok := vars[name]; !ok {
+			t.Errorf("missing %s", name)
+		}
+	}
+}
+
+func TestActionDiscovery(t *testing.T) {
+	var cfg = &config{
+		Backend:  "crm",
+		Backends: []backendConfig{{Name: "crm", Type: backendFile}},
+		Actions:  map[string]actionConfig{"GetAccountByAccountNumber": {Cache: &cacheConfig{TTL: duration(time.Minute)}}},
+	}
+	var h = newTestRouter(cfg, datadiptest.NewStore(), 3*time.Second)
+
+	var rec = datadiptest.Do(h, "GET", "/actions", "")
+	var body struct {
+		Actions []map[string]interface{} `json:"actions"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); rec.Code != http.StatusOK || err != nil {
+		t.Fatalf("status = %d, body %q", rec.Code, rec.Body.String())
+	}
+	if len(body.Actions) != len(datadip.Actions) {
+		t.Fatalf("%d actions listed, want %d", len(body.Actions), len(datadip.Actions))
+	}
+	var found, stub = body.Actions[0], body.Actions[1]
+	if found["name"] != "GetAccountByAccountNumber" || found["implemented"] != true || found["backend"] != "crm" || found["backendType"] != "file" ||
+		found["timeout"] != "3s" || found["cache"] == nil || found["request"] == nil || found["response"] == nil {
+		t.Errorf("implemented action = %v", found)
+	}
+	if stub["name"] != "GetAccountByContactId" || stub["implemented"] != false || stub["backend"] != nil || stub["path"] != "/GetAccountByContactId" {
+		t.Errorf("stub action = %v", stub)
+	}
+}
+
+func TestActionValidation(t *testing.T) {
+	var cfg = &config{Actions: map[string]actionConfig{
+		"GetAccountByAccountNumber": {Validation: &validationConfig{
+			RequireJSON: true,
+			Fields:      map[string]fieldRuleConfig{"AccountNumber": {Pattern: "[0-9]{3}|[0-9]{3}-[0-9]{4}"}},
+		}},
+	}}
+	cfg.applyDefaults()
+	if problems := cfg.validate(); len(problems) > 0 {
+		t.Fatal(problems)
+	}
+	var d, err = newDataDip(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var h = newRouter(cfg, d)
+	if rec := datadiptest.Do(h, "POST", "/GetAccountByAccountNumber", `{"AccountNumber":"123"}`); rec.Code != http.StatusOK {
+		t.Errorf("valid request: status = %d, body %q", rec.Code, rec.Body.String())
+	}
+	// The whole value must match, by either alternative, and not just its start
+	if rec := datadiptest.Do(h, "POST", "/GetAccountByAccountNumber", `{"AccountNumber":"123-4567"}`); rec.Code == http.StatusBadRequest {
+		t.Errorf("valid request by the longer alternative: status = %d, body %q", rec.Code, rec.Body.String())
+	}
+	if rec := datadiptest.Do(h, "POST", "/GetAccountByAccountNumber", `{"AccountNumber":"1234"}`); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `"field":"AccountNumber"`) {
+		t.Errorf("invalid request: status = %d, body %q", rec.Code, rec.Body.String())
+	}
+
+	cfg.Actions["GetContactByPhoneNumber"] = actionConfig{Validation: &validationConfig{
+		Fields: map[string]fieldRuleConfig{"AccountNumber": {}, "PhoneNumber": {Pattern: "[0-9", MinLength: 5, MaxLength: 2}, "CustomAttribute": {Pattern: `\Qabc`}},
+	}}
+	var want = []string{
+		`actions.GetContactByPhoneNumber: validation.fields: "AccountNumber" is not a field of the request`,
+		// A pattern that compiles on its own but not once anchored is refused as well
+		"actions.GetContactByPhoneNumber: validation.fields.CustomAttribute.pattern: error parsing regexp: missing closing ): `^(?:\\Qabc)$`",
+		"actions.GetContactByPhoneNumber: validation.fields.PhoneNumber.pattern: error parsing regexp: missing closing ]: `[0-9`",
+		"actions.GetContactByPhoneNumber: validation.fields.PhoneNumber: minLength and maxLength must not be negative, and minLength at most maxLength",
+	}
+	if got := cfg.validate(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("problems = %q, want %q", got, want)
+	}
+}
+
+// countingReader counts the bytes read from it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	var n, err = c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func TestActionBodyLimit(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "limit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var path = filepath.Join(dir, "traffic.jsonl")
+	defer recentLookups.setLimit(defaultRecentLookups)
+	recentLookups.setLimit(0)
+	recentLookups.setLimit(1)
+
+	var d = newTestDataDip(datadiptest.NewStore(), time.Second)
+	if d.recorder, err = openTrafficRecorder(path); err != nil {
+		t.Fatal(err)
+	}
+	var h = newRouter(&config{}, d)
+
+	// A body well over the limit is refused, and neither read in full nor kept by the middleware that copy it
+	var body = &countingReader{r: strings.NewReader(`{"AccountNumber":"123","Padding":"` + strings.Repeat("x", 1<<20) + `"}`)}
+	var req = httptest.NewRequest("POST", "/"+datadip.ActionGetAccountByAccountNumber, body)
+	req.Header.Set("Content-Type", "application/json")
+	var rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "body must be at most 65536 bytes") {
+		t.Errorf("status = %d, body %q", rec.Code, rec.Body.String())
+	}
+	if body.n > 2*datadip.DefaultMaxBodySize {
+		t.Errorf("read %d bytes of the body, want at most %d", body.n, 2*datadip.DefaultMaxBodySize)
+	}
+	var lookups = recentLookups.recent()
+	if len(lookups) != 1 || len(lookups[0].Request) > datadip.DefaultMaxBodySize+1 {
+		t.Errorf("kept %d lookups, the last with a %d byte request", len(lookups), len(lookups[len(lookups)-1].Request))
+	}
+	var data []byte
+	if data, err = ioutil.ReadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if len(data) > 2*datadip.DefaultMaxBodySize {
+		t.Errorf("recorded %d bytes for the request", len(data))
+	}
+}
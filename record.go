@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"purecloudwebservice/datadip"
+)
+
+// trafficEntry is one request an action answered and the reply sent, as the traffic recorder writes it. Header holds
+// the request headers except Authorization, so that recordings do not hold credentials.
+type trafficEntry struct {
+	Time           time.Time   `json:"time"`
+	Action         string      `json:"action"`
+	Header         http.Header `json:"header,omitempty"`
+	Request        string      `json:"request"`
+	Status         int         `json:"status"`
+	ResponseHeader http.Header `json:"responseHeader,omitempty"`
+	Response       string      `json:"response"`
+}
+
+// trafficRecorder appends traffic entries to a file
+type trafficRecorder struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// trafficRecorders holds the recorders opened, by absolute path, so that configuration reloads keep writing through
+// the same file.
+var trafficRecorders = struct {
+	sync.Mutex
+	recorders map[string]*trafficRecorder
+}{recorders: make(map[string]*trafficRecorder)}
+
+// openTrafficRecorder returns the recorder appending to the file at path, creating the file if needed.
+func openTrafficRecorder(path string) (*trafficRecorder, error) {
+	var err error
+	if path, err = filepath.Abs(path); err != nil {
+		return nil, err
+	}
+	trafficRecorders.Lock()
+	defer trafficRecorders.Unlock()
+	if rec, ok := trafficRecorders.recorders[path]; ok {
+		return rec, nil
+	}
+
+	var f *os.File
+	if f, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600); err != nil {
+		return nil, fmt.Errorf("traffic recorder: %s", err)
+	}
+	var rec = &trafficRecorder{path: path, file: f}
+	trafficRecorders.recorders[path] = rec
+	return rec, nil
+}
+
+// add appends e to the recording. A failed write is logged.
+func (t *trafficRecorder) add(e trafficEntry) {
+	var b, _ = json.Marshal(e)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, err := t.file.Write(append(b, '\n')); err != nil {
+		log.Printf("Failed to write traffic recording %s: %s\n", t.path, err)
+	}
+}
+
+// recordTraffic returns a Middleware that writes every request an action answers, with its reply, to t.
+func recordTraffic(t *trafficRecorder) datadip.Middleware {
+	return func(action string, next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body, _ = ioutil.ReadAll(r.Body)
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			var rec = &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+			var start = time.Now()
+			next.ServeHTTP(rec, r)
+			var header = r.Header.Clone()
+			header.Del("Authorization")
+			t.add(trafficEntry{
+				Time:           start.UTC(),
+				Action:         action,
+				Header:         header,
+				Request:        string(body),
+				Status:         rec.status,
+				ResponseHeader: w.Header().Clone(),
+				Response:       rec.body.String(),
+			})
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"purecloudwebservice/datadip"
+	"purecloudwebservice/datadip/datadiptest"
+)
+
+func TestRecordTraffic(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var path = filepath.Join(dir, "traffic.jsonl")
+
+	var d = newTestDataDip(datadiptest.NewStore(), time.Second)
+	if d.recorder, err = openTrafficRecorder(path); err != nil {
+		t.Fatal(err)
+	}
+	var cfg = &config{Auth: &authConfig{Users: []userConfig{{Username: "purecloud", Password: "secret"}}}}
+	var h = newRouter(cfg, d)
+	for _, body := range []string{`{"AccountNumber":"123"}`, `{"AccountNumber":"999"}`} {
+		var req = httptest.NewRequest("POST", "/"+datadip.ActionGetAccountByAccountNumber, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.SetBasicAuth("purecloud", "secret")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	var data []byte
+	if data, err = ioutil.ReadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	var lines = bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("recorded %d requests, want 2:\n%s", len(lines), data)
+	}
+	var entries = make([]trafficEntry, len(lines))
+	for i, line := range lines {
+		if err = json.Unmarshal(line, &entries[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if e := entries[0]; e.Action != datadip.ActionGetAccountByAccountNumber || e.Request != `{"AccountNumber":"123"}` || e.Status != http.StatusOK ||
+		e.Header.Get("Content-Type") != "application/json" || e.ResponseHeader.Get("Content-Type") != "application/json" || !strings.Contains(e.Response, `"Ng Sze Min"`) {
+		t.Errorf("first entry = %+v", e)
+	}
+	if e := entries[1]; e.Status != http.StatusNotFound {
+		t.Errorf("second entry = %+v", e)
+	}
+	if bytes.Contains(data, []byte("Authorization")) {
+		t.Errorf("recording holds credentials:\n%s", data)
+	}
+
+	// Replaying against the same store gives the same replies; a change in the data is reported
+	for _, e := range entries {
+		var req = httptest.NewRequest("POST", "/"+e.Action, strings.NewReader(e.Request))
+		req.Header = e.Header
+		req.SetBasicAuth("purecloud", "secret")
+		var rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		var got = replayResult{status: rec.Code, contentType: rec.Header().Get("Content-Type"), body: rec.Body.String()}
+		if problems := compareReplay(e, got); len(problems) > 0 {
+			t.Errorf("replay of %s differs: %q", e.Request, problems)
+		}
+	}
+	var changed = entries[0]
+	changed.Response = strings.Replace(changed.Response, "Ng Sze Min", "Someone Else", 1)
+	if problems := compareReplay(changed, replayResult{status: http.StatusOK, contentType: "application/json", body: entries[0].Response}); len(problems) != 2 {
+		t.Errorf("replay of a changed body: problems = %q, want the body reported", problems)
+	}
+}
+
+func TestReplayConfig(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var configFile = filepath.Join(dir, "config.json")
+	var recording = filepath.Join(dir, "traffic.jsonl")
+	var auditFile = filepath.Join(dir, "audit.jsonl")
+	var traffic = filepath.Join(dir, "replayed.jsonl")
+
+	// Replaying against a configuration that audits and records lookups leaves both files alone
+	var b, _ = json.Marshal(map[string]interface{}{"audit": map[string]string{"file": auditFile}, "record": map[string]string{"file": traffic}})
+	if err = ioutil.WriteFile(configFile, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	b, _ = json.Marshal(trafficEntry{Action: datadip.ActionGetAccountByAccountNumber, Request: `{"AccountNumber":"123"}`, Status: http.StatusOK})
+	if err = ioutil.WriteFile(recording, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	replay([]string{"-config", configFile, recording})
+	for _, path := range []string{auditFile, traffic} {
+		if _, err = os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s was written by the replay", filepath.Base(path))
+		}
+	}
+}
+
+func TestSameBody(t *testing.T) {
+	var tests = []struct {
+		a, b string
+		same bool
+	}{
+		{`{"Account":{"Id":"1","Name":"x"}}`, "{\"Account\": {\"Name\": \"x\", \"Id\": \"1\"}}\n", true},
+		{`{"Account":{"Id":"1"}}`, `{"Account":{"Id":"2"}}`, false},
+		{"record not found\n", "record not found", true},
+		{"record not found", `{"Account":{}}`, false},
+	}
+	for _, tt := range tests {
+		if got := sameBody(tt.a, tt.b); got != tt.same {
+			t.Errorf("sameBody(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.same)
+		}
+	}
+}
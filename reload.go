@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// configPollInterval is how often the configuration file is checked for changes
+const configPollInterval = 2 * time.Second
+
+// swapHandler is an http.Handler whose underlying handler can be replaced atomically while it serves requests
+type swapHandler struct {
+	v atomic.Value
+}
+
+func (h *swapHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.v.Load().(http.Handler).ServeHTTP(w, r)
+}
+
+// set replaces the underlying handler. Requests already being served finish with the old one.
+func (h *swapHandler) set(handler http.Handler) {
+	h.v.Store(handler)
+}
+
+// reloader reloads the configuration file and swaps the routes, backends and auth it describes into a running server
+type reloader struct {
+	path    string
+	handler *swapHandler
+	admin   *swapHandler // serves the admin API when it has its own listen address, otherwise nil
+
+	mu  sync.Mutex
+	cfg *config
+	d   *dataDip
+}
+
+// install makes cfg and d the ones in use: requests are routed to d and readiness checks and metrics look at d's
+// backends, readiness checks leaving out those that only take shadow lookups.
+func (rl *reloader) install(cfg *config, d *dataDip) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	setBreakers(d.breakers, d.shadowOnly)
+	setBulkheads(d.bulkheads)
+	if cfg.Admin != nil {
+		recentLookups.setLimit(cfg.Admin.RecentLookups)
+	}
+	rl.handler.set(newRouter(cfg, d))
+	if rl.admin != nil {
+		rl.admin.set(newAdminRouter(cfg, d))
+	}
+	rl.cfg = cfg
+	rl.d = d
+}
+
+// reload reads and validates the configuration file and, if it is valid and its backends can be built, swaps it in.
+// Otherwise the configuration in use is kept. Backends whose settings are unchanged keep their circuit breakers and
+// caches.
+func (rl *reloader) reload() {
+	var err error
+
+	log.Printf("Reloading configuration from %s...\n", rl.path)
+	var cfg *config
+	if cfg, err = loadConfig(rl.path); err != nil {
+		log.Printf("Keeping current configuration: %s\n", err)
+		return
+	}
+
+	rl.mu.Lock()
+	var old, prev = rl.cfg, rl.d
+	rl.mu.Unlock()
+
+	var d *dataDip
+	if d, err = rebuildDataDip(cfg, old, prev); err != nil {
+		log.Printf("Keeping current configuration: %s\n", err)
+		return
+	}
+
+	var changes = diffConfig(old, cfg)
+	if len(changes) == 0 {
+		log.Println("Configuration unchanged")
+	}
+	for _, c := range changes {
+		log.Printf("Configuration changed: %s\n", c)
+	}
+	if cfg.Listen != old.Listen || !reflect.DeepEqual(cfg.TLS, old.TLS) || adminListen(cfg) != adminListen(old) {
+		log.Println("Changes to listen, tls and admin.listen take effect after a restart")
+	}
+	rl.install(cfg, d)
+	log.Println("Configuration reloaded")
+}
+
+// watch reloads the configuration whenever a signal arrives on signals or the configuration file changes. It never
+// returns.
+func (rl *reloader) watch(signals <-chan os.Signal) {
+	var modTime, size = statConfig(rl.path)
+	var ticker = time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-signals:
+			modTime, size = statConfig(rl.path)
+			rl.reload()
+		case <-ticker.C:
+			var m, s = statConfig(rl.path)
+			if m.Equal(modTime) && s == size {
+				continue
+			}
+			modTime, size = m, s
+			rl.reload()
+		}
+	}
+}
+
+// adminListen returns the admin API's own listen address in cfg, or "" if it has none.
+func adminListen(cfg *config) string {
+	if cfg.Admin == nil {
+		return ""
+	}
+	return cfg.Admin.Listen
+}
+
+// statConfig returns the modification time and size of the file at path, or zero values if it cannot be read.
+func statConfig(path string) (time.Time, int64) {
+	var fi, err = os.Stat(path)
+	if err != nil {
+		return time.Time{}, 0
+	}
+	return fi.ModTime(), fi.Size()
+}
+
+// diffConfig describes each setting that differs between old and new, one per line, e.g.
+// `actions.GetAccountByAccountNumber.timeout: "5s" -> "3s"`. Backends are compared by name and passwords are not
+// shown.
+func diffConfig(old, new *config) []string {
+	var before, after = flattenConfig(old), flattenConfig(new)
+
+	var keys []string
+	for k := range before {
+		keys = append(keys, k)
+	}
+	for k := range after {
+		if _, ok := before[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var changes []string
+	for _, k := range keys {
+		var b, inBefore = before[k]
+		var a, inAfter = after[k]
+		if strings.HasSuffix(k, "password") {
+			b, a = `"********"`, `"********"`
+		}
+		switch {
+		case !inBefore:
+			changes = append(changes, fmt.Sprintf("%s: added %s", k, a))
+		case !inAfter:
+			changes = append(changes, fmt.Sprintf("%s: removed", k))
+		case before[k] != after[k]:
+			changes = append(changes, fmt.Sprintf("%s: %s -> %s", k, b, a))
+		}
+	}
+	return changes
+}
+
+// flattenConfig returns every setting in cfg as a dotted path mapped to its JSON value.
+func flattenConfig(cfg *config) map[string]string {
+	var flat = make(map[string]string)
+
+	// Round trip through JSON so the paths match the file, keying backends by name rather than position
+	var b, _ = json.Marshal(cfg)
+	var v map[string]interface{}
+	json.Unmarshal(b, &v)
+	if list, ok := v["backends"].([]interface{}); ok {
+		var byName = make(map[string]interface{})
+		for _, item := range list {
+			if m, ok := item.(map[string]interface{}); ok {
+				byName[fmt.Sprint(m["name"])] = m
+			}
+		}
+		v["backends"] = byName
+	}
+
+	var walk func(path string, v interface{})
+	walk = func(path string, v interface{}) {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			for k, child := range t {
+				var p = k
+				if path != "" {
+					p = path + "." + k
+				}
+				walk(p, child)
+			}
+		case []interface{}:
+			for i, child := range t {
+				walk(fmt.Sprintf("%s[%d]", path, i), child)
+			}
+		default:
+			var b, _ = json.Marshal(t)
+			flat[path] = string(b)
+		}
+	}
+	walk("", v)
+	return flat
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRebuildDataDip(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var path = filepath.Join(dir, "records.json")
+	if err = ioutil.WriteFile(path, []byte(`{"Accounts": [{"Id": "1", "Number": "123"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var newConfig = func(attempts int) *config {
+		var cfg = &config{
+			Backend: "crm",
+			Backends: []backendConfig{
+				{Name: "crm", Type: backendFile, File: path},
+				{Name: "marketing", Type: backendSample, Retry: &retryConfig{Attempts: attempts}},
+			},
+			Actions: map[string]actionConfig{
+				"GetAccountByAccountNumber": {Cache: &cacheConfig{TTL: duration(time.Minute)}},
+				"GetContactByPhoneNumber":   {Backend: "marketing", Cache: &cacheConfig{TTL: duration(time.Minute)}},
+			},
+		}
+		cfg.applyDefaults()
+		if problems := cfg.validate(); len(problems) > 0 {
+			t.Fatal(problems)
+		}
+		return cfg
+	}
+	var old = newConfig(1)
+	var prev *dataDip
+	if prev, err = newDataDip(old); err != nil {
+		t.Fatal(err)
+	}
+
+	// Edit the file and the marketing backend's settings
+	if err = ioutil.WriteFile(path, []byte(`{"Accounts": [{"Id": "2", "Number": "123"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var cfg = newConfig(2)
+
+	// A build that fails leaves the kept file backend answering from the file as it was
+	var failing = newConfig(2)
+	failing.Audit = &auditConfig{File: filepath.Join(dir, "missing", "audit.log")}
+	if _, err = rebuildDataDip(failing, old, prev); err == nil {
+		t.Fatal("build with an audit log that cannot be opened succeeded")
+	}
+	if account, _ := prev.files["crm"].GetAccountByAccountNumber(context.Background(), "123"); account == nil || account.ID != "1" {
+		t.Errorf("after a failed build, account = %+v, want the one with Id 1", account)
+	}
+
+	var d *dataDip
+	if d, err = rebuildDataDip(cfg, old, prev); err != nil {
+		t.Fatal(err)
+	}
+
+	if d.backends["crm"] != prev.backends["crm"] || d.breakers["crm"] != prev.breakers["crm"] || d.files["crm"] != prev.files["crm"] {
+		t.Error("unchanged backend crm was rebuilt")
+	}
+	if d.routes["GetAccountByAccountNumber"].store != prev.routes["GetAccountByAccountNumber"].store {
+		t.Error("cache of GetAccountByAccountNumber, whose backend is unchanged, was rebuilt")
+	}
+	if d.backends["marketing"] == prev.backends["marketing"] || d.breakers["marketing"] == prev.breakers["marketing"] {
+		t.Error("changed backend marketing was kept")
+	}
+	if d.routes["GetContactByPhoneNumber"].store == prev.routes["GetContactByPhoneNumber"].store {
+		t.Error("cache of GetContactByPhoneNumber, whose backend changed, was kept")
+	}
+
+	// A kept file backend answers from the file as it is now
+	var account, _ = d.files["crm"].GetAccountByAccountNumber(context.Background(), "123")
+	if account == nil || account.ID != "2" {
+		t.Errorf("account = %+v, want the one with Id 2", account)
+	}
+}
+
+func TestDiffConfig(t *testing.T) {
+	var old = &config{
+		Listen:  ":8080",
+		Auth:    &authConfig{Users: []userConfig{{Username: "purecloud", Password: "secret"}}},
+		Backend: "crm",
+		Backends: []backendConfig{
+			{Name: "crm", Type: backendSample},
+			{Name: "marketing", Type: backendSample},
+		},
+		Actions: map[string]actionConfig{"GetAccountByAccountNumber": {Timeout: duration(5 * time.Second)}},
+	}
+	// The same backends in another order, with one changed
+	var new = &config{
+		Listen:  ":8080",
+		Auth:    &authConfig{Users: []userConfig{{Username: "purecloud", Password: "changed"}}},
+		Backend: "crm",
+		Backends: []backendConfig{
+			{Name: "marketing", Type: backendFile, File: "marketing.json"},
+			{Name: "crm", Type: backendSample},
+		},
+		Actions: map[string]actionConfig{"GetAccountByAccountNumber": {Timeout: duration(3 * time.Second)}},
+	}
+
+	var tests = []struct {
+		name     string
+		old, new *config
+		want     []string
+	}{
+		{"unchanged", old, old, nil},
+		{"changed", old, new, []string{
+			`actions.GetAccountByAccountNumber.timeout: "5s" -> "3s"`,
+			`auth.users[0].password: "********" -> "********"`,
+			`backends.marketing.file: added "marketing.json"`,
+			`backends.marketing.type: "sample" -> "file"`,
+		}},
+		{"removed", new, &config{Listen: ":8080", Backend: "crm"}, []string{
+			`actions.GetAccountByAccountNumber.timeout: removed`,
+			`auth.users[0].password: removed`,
+			`auth.users[0].username: removed`,
+			`backends.crm.name: removed`,
+			`backends.crm.type: removed`,
+			`backends.marketing.file: removed`,
+			`backends.marketing.name: removed`,
+			`backends.marketing.type: removed`,
+		}},
+	}
+	for _, tt := range tests {
+		if got := diffConfig(tt.old, tt.new); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: changes =\n%s\nwant\n%s", tt.name, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+	}
+}
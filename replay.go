@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+
+	"purecloudwebservice/datadip"
+)
+
+// replayResult is the reply to a replayed request, or the error that stopped it being sent
+type replayResult struct {
+	status      int
+	contentType string
+	body        string
+	err         error
+}
+
+// replay runs the replay subcommand with args. It sends every request in a traffic recording again, to a running
+// service with -url or else through the handler and backends in the configuration, and reports each reply that
+// differs from the recorded one. It returns 1 if any did.
+func replay(args []string) int {
+	var flags = flag.NewFlagSet("replay", flag.ExitOnError)
+	var configFlag = flags.String("config", "", "configuration file to replay against when -url is not given, defaults to $"+configEnv)
+	var baseURL = flags.String("url", "", "base URL of a running service to replay against")
+	var username = flags.String("user", "", "HTTP Basic username to send with -url")
+	var password = flags.String("password", "", "HTTP Basic password to send with -url")
+	var timeout = flags.Duration("timeout", datadip.DefaultTimeout, "how long to wait for each reply with -url")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: purecloudwebservice replay [-config file | -url url [-user name -password secret] [-timeout d]] recording")
+		return 2
+	}
+	var data, err = ioutil.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// Requests are sent with send, to the running service or to a handler built from the configuration
+	var send func(e trafficEntry) replayResult
+	if *baseURL != "" {
+		var client = &http.Client{Timeout: *timeout}
+		send = func(e trafficEntry) replayResult {
+			var req, err = http.NewRequest("POST", strings.TrimRight(*baseURL, "/")+"/"+e.Action, strings.NewReader(e.Request))
+			if err != nil {
+				return replayResult{err: err}
+			}
+			for name, values := range e.Header {
+				// The reply is compared decoded, so leave compression to the transport
+				if name != "Accept-Encoding" {
+					req.Header[name] = values
+				}
+			}
+			if *username != "" || *password != "" {
+				req.SetBasicAuth(*username, *password)
+			}
+			var resp *http.Response
+			if resp, err = client.Do(req); err != nil {
+				return replayResult{err: err}
+			}
+			defer resp.Body.Close()
+			var body []byte
+			if body, err = ioutil.ReadAll(resp.Body); err != nil {
+				return replayResult{err: err}
+			}
+			return replayResult{status: resp.StatusCode, contentType: resp.Header.Get("Content-Type"), body: string(body)}
+		}
+	} else {
+		var cfg *config
+		if cfg, err = loadOfflineConfig(configPath(*configFlag)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		// Replayed requests need no credentials
+		cfg.Auth = nil
+		var d *dataDip
+		if d, err = newDataDip(cfg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		var h = newRouter(cfg, d)
+		send = func(e trafficEntry) replayResult {
+			var req = actionRequest(context.Background(), e.Action, []byte(e.Request))
+			for name, values := range e.Header {
+				req.Header[name] = values
+			}
+			var rec = datadip.NewRecorder()
+			h.ServeHTTP(rec, req)
+			return replayResult{status: rec.Status, contentType: rec.Header().Get("Content-Type"), body: rec.Body.String()}
+		}
+	}
+
+	var replayed, differ int
+	for n, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var e trafficEntry
+		if err = json.Unmarshal(line, &e); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: line %d: %s\n", flags.Arg(0), n+1, err)
+			return 1
+		}
+		replayed++
+		var problems = compareReplay(e, send(e))
+		if len(problems) == 0 {
+			continue
+		}
+		differ++
+		fmt.Printf("line %d: %s %s\n", n+1, e.Action, e.Request)
+		for _, p := range problems {
+			fmt.Printf("  %s\n", p)
+		}
+	}
+	fmt.Printf("%d requests replayed, %d differ\n", replayed, differ)
+	if differ > 0 {
+		return 1
+	}
+	return 0
+}
+
+// compareReplay describes each way got differs from the reply recorded in e: its status, Content-Type and body. JSON
+// bodies are compared by value, so field order and spacing do not matter.
+func compareReplay(e trafficEntry, got replayResult) []string {
+	if got.err != nil {
+		return []string{fmt.Sprintf("request failed: %s", got.err)}
+	}
+	var problems []string
+	if got.status != e.Status {
+		problems = append(problems, fmt.Sprintf("status: recorded %d, replayed %d", e.Status, got.status))
+	}
+	if want := e.ResponseHeader.Get("Content-Type"); got.contentType != want {
+		problems = append(problems, fmt.Sprintf("Content-Type: recorded %q, replayed %q", want, got.contentType))
+	}
+	if !sameBody(e.Response, got.body) {
+		problems = append(problems, fmt.Sprintf("body: recorded %s", strings.TrimSpace(e.Response)))
+		problems = append(problems, fmt.Sprintf("      replayed %s", strings.TrimSpace(got.body)))
+	}
+	return problems
+}
+
+// sameBody reports whether two reply bodies are the same JSON value, or the same text if either is not JSON.
+func sameBody(a, b string) bool {
+	var va, vb interface{}
+	if json.Unmarshal([]byte(a), &va) != nil || json.Unmarshal([]byte(b), &vb) != nil {
+		return strings.TrimSpace(a) == strings.TrimSpace(b)
+	}
+	return reflect.DeepEqual(va, vb)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"math/rand"
+	"time"
+
+	"purecloudwebservice/datadip"
+)
+
+// retryPolicy says how many times a failed lookup is attempted and how long to back off between attempts. Backoff
+// doubles from BaseDelay up to MaxDelay and is fully jittered, so the actual wait is a random duration up to that.
+type retryPolicy struct {
+	Attempts  int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// defaultRetryPolicy is used for backends that do not set their own retry policy
+var defaultRetryPolicy = retryPolicy{Attempts: 2, BaseDelay: 50 * time.Millisecond, MaxDelay: 500 * time.Millisecond}
+
+// retries counts lookup retries per backend
+var retries = expvar.NewMap("retries")
+
+// retryingStore wraps a Store and retries failed lookups according to a retryPolicy. Lookups are idempotent so it is
+// safe to repeat them. ErrNotFound is an answer, not a failure, and is never retried.
+type retryingStore struct {
+	name    string
+	backend datadip.CaseStore
+	policy  retryPolicy
+}
+
+// newRetryingStore returns a Store that retries failed lookups against backend, counting retries under name.
+func newRetryingStore(name string, backend datadip.CaseStore, policy retryPolicy) *retryingStore {
+	return &retryingStore{name: name, backend: backend, policy: policy}
+}
+
+// GetAccountByAccountNumber looks up an account, retrying if the backend fails.
+func (s *retryingStore) GetAccountByAccountNumber(ctx context.Context, accountNumber string) (*datadip.Account, error) {
+	var account *datadip.Account
+	var err = s.do(ctx, func() error {
+		var err error
+		account, err = s.backend.GetAccountByAccountNumber(ctx, accountNumber)
+		return err
+	})
+	return account, err
+}
+
+// GetContactByPhoneNumber looks up a contact, retrying if the backend fails.
+func (s *retryingStore) GetContactByPhoneNumber(ctx context.Context, phoneNumber string) (*datadip.Contact, error) {
+	var contact *datadip.Contact
+	var err = s.do(ctx, func() error {
+		var err error
+		contact, err = s.backend.GetContactByPhoneNumber(ctx, phoneNumber)
+		return err
+	})
+	return contact, err
+}
+
+// GetMostRecentOpenCaseByContactID looks up a case, retrying if the backend fails.
+func (s *retryingStore) GetMostRecentOpenCaseByContactID(ctx context.Context, contactID string) (*datadip.Case, error) {
+	var c *datadip.Case
+	var err = s.do(ctx, func() error {
+		var err error
+		c, err = s.backend.GetMostRecentOpenCaseByContactID(ctx, contactID)
+		return err
+	})
+	return c, err
+}
+
+// do calls fn until it succeeds, returns ErrNotFound, runs out of attempts or ctx is done.
+func (s *retryingStore) do(ctx context.Context, fn func() error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = fn(); err == nil || err == datadip.ErrNotFound || attempt+1 >= s.policy.Attempts || ctx.Err() != nil {
+			return err
+		}
+
+		// Back off before trying again
+		var timer = time.NewTimer(s.policy.backoff(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+		retries.Add(s.name, 1)
+	}
+}
+
+// backoff returns a random duration to wait after the given zero-based attempt failed.
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	var d = p.BaseDelay
+	for i := 0; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"purecloudwebservice/datadip"
+	"purecloudwebservice/datadip/datadiptest"
+)
+
+// failing returns a store hook failing the first n lookups with err
+func failing(n int, err error) func(context.Context, string) error {
+	return func(ctx context.Context, key string) error {
+		if n > 0 {
+			n--
+			return err
+		}
+		return nil
+	}
+}
+
+func TestRetryingStore(t *testing.T) {
+	var crmDown = errors.New("crm down")
+	var policy = retryPolicy{Attempts: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond}
+	var tests = []struct {
+		name     string
+		failures int
+		err      error
+		key      string
+		calls    int
+		want     error
+	}{
+		{"success", 0, nil, "123", 1, nil},
+		{"recovers after failures", 2, crmDown, "123", 3, nil},
+		{"runs out of attempts", 3, crmDown, "123", 3, crmDown},
+		{"not found is not retried", 0, nil, "999", 1, datadip.ErrNotFound},
+	}
+	for _, tt := range tests {
+		var backend = datadiptest.NewStore()
+		backend.Hook = failing(tt.failures, tt.err)
+		var s = newRetryingStore("test", backend, policy)
+		if _, err := s.GetAccountByAccountNumber(context.Background(), tt.key); err != tt.want {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+		if n := backend.Calls(); n != tt.calls {
+			t.Errorf("%s: backend calls = %d, want %d", tt.name, n, tt.calls)
+		}
+	}
+
+	// A lookup whose context is done is not retried, nor is the backoff waited out
+	var backend = datadiptest.NewStore()
+	backend.Err = crmDown
+	var s = newRetryingStore("test", backend, retryPolicy{Attempts: 5, BaseDelay: time.Hour, MaxDelay: time.Hour})
+	var ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	var start = time.Now()
+	if _, err := s.GetContactByPhoneNumber(ctx, "+60327763333"); err != crmDown || time.Since(start) > time.Second {
+		t.Errorf("cancelled lookup: err = %v after %s", err, time.Since(start))
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	var p = retryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 25 * time.Millisecond}
+	var tests = []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{0, 10 * time.Millisecond},
+		{1, 20 * time.Millisecond},
+		{2, 25 * time.Millisecond},
+		{30, 25 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		var longest time.Duration
+		for i := 0; i < 1000; i++ {
+			var d = p.backoff(tt.attempt)
+			if d < 0 || d > tt.max {
+				t.Fatalf("attempt %d: backoff = %s, want at most %s", tt.attempt, d, tt.max)
+			}
+			if d > longest {
+				longest = d
+			}
+		}
+		// Jitter spreads backoffs over the whole range
+		if longest < tt.max/2 {
+			t.Errorf("attempt %d: longest backoff = %s, want close to %s", tt.attempt, longest, tt.max)
+		}
+	}
+	if d := (retryPolicy{}).backoff(3); d != 0 {
+		t.Errorf("no delay: backoff = %s, want 0", d)
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"purecloudwebservice/datadip"
+)
+
+// ruleConfig computes routing attributes, such as a VIP tier, target queue or language, from a lookup. When every
+// condition in When holds, the rule sets the attributes in Set, unless an earlier rule has set them already. The rule
+// applies to the actions listed in Actions, or to every action if there are none.
+type ruleConfig struct {
+	Name    string            `json:"name"`
+	Actions []string          `json:"actions,omitempty"`
+	When    []conditionConfig `json:"when,omitempty"`
+	Set     map[string]string `json:"set"`
+}
+
+// conditionConfig is one condition of a rule. It tests either Field, a field of the response flattened as Architect
+// sees it, e.g. "Account.Name" or "Case.Status", or of the request, e.g. "Request.PhoneNumber", with Op; or the time
+// of day and day of the week in Zone, the local time zone by default.
+type conditionConfig struct {
+	Field  string   `json:"field,omitempty"`
+	Op     string   `json:"op,omitempty"`
+	Value  string   `json:"value,omitempty"`
+	Values []string `json:"values,omitempty"`
+
+	// Time is a range of times of day such as "09:00-17:30", which may span midnight, and Days lists days such as
+	// "Mon" and "Sat"
+	Time string   `json:"time,omitempty"`
+	Days []string `json:"days,omitempty"`
+	Zone string   `json:"zone,omitempty"`
+}
+
+// Condition operators. Each compares a field's value, as text, with Value or Values.
+var conditionOps = map[string]func(c *condition, v string, ok bool) bool{
+	"equals":    func(c *condition, v string, ok bool) bool { return ok && v == c.Value },
+	"notEquals": func(c *condition, v string, ok bool) bool { return !ok || v != c.Value },
+	"in":        func(c *condition, v string, ok bool) bool { return ok && contains(c.Values, v) },
+	"notIn":     func(c *condition, v string, ok bool) bool { return !ok || !contains(c.Values, v) },
+	"prefix":    func(c *condition, v string, ok bool) bool { return ok && strings.HasPrefix(v, c.Value) },
+	"suffix":    func(c *condition, v string, ok bool) bool { return ok && strings.HasSuffix(v, c.Value) },
+	"contains":  func(c *condition, v string, ok bool) bool { return ok && strings.Contains(v, c.Value) },
+	"matches":   func(c *condition, v string, ok bool) bool { return ok && c.pattern.MatchString(v) },
+	"set":       func(c *condition, v string, ok bool) bool { return ok },
+	"notSet":    func(c *condition, v string, ok bool) bool { return !ok },
+}
+
+// weekdays maps the day names a condition may list to days
+var weekdays = map[string]time.Weekday{
+	"Sun": time.Sunday, "Mon": time.Monday, "Tue": time.Tuesday, "Wed": time.Wednesday,
+	"Thu": time.Thursday, "Fri": time.Friday, "Sat": time.Saturday,
+}
+
+// ruleSet is the rules in a configuration, ready to evaluate
+type ruleSet struct {
+	rules []rule
+}
+
+type rule struct {
+	ruleConfig
+	conditions []*condition
+}
+
+type condition struct {
+	conditionConfig
+	pattern  *regexp.Regexp
+	zone     *time.Location
+	from, to time.Duration
+}
+
+// newRuleSet compiles rules, returning what is wrong with the first rule that cannot be.
+func newRuleSet(rules []ruleConfig) (*ruleSet, error) {
+	var rs = new(ruleSet)
+	for i, rc := range rules {
+		var r = rule{ruleConfig: rc}
+		for j, cc := range rc.When {
+			var c, err = newCondition(cc)
+			if err != nil {
+				return nil, fmt.Errorf("rules[%d].when[%d]: %s", i, j, err)
+			}
+			r.conditions = append(r.conditions, c)
+		}
+		rs.rules = append(rs.rules, r)
+	}
+	return rs, nil
+}
+
+// newCondition compiles cc.
+func newCondition(cc conditionConfig) (*condition, error) {
+	var err error
+	var c = &condition{conditionConfig: cc, zone: time.Local}
+	if cc.Field == "" && cc.Time == "" && len(cc.Days) == 0 {
+		return nil, fmt.Errorf("field, time or days is required")
+	}
+	if cc.Field != "" {
+		if cc.Time != "" || len(cc.Days) > 0 || cc.Zone != "" {
+			return nil, fmt.Errorf("a condition tests either a field or the time, not both")
+		}
+		if _, ok := conditionOps[cc.Op]; !ok {
+			return nil, fmt.Errorf("unknown op %q", cc.Op)
+		}
+		if cc.Op == "matches" {
+			if c.pattern, err = regexp.Compile(cc.Value); err != nil {
+				return nil, err
+			}
+		}
+		if (cc.Op == "in" || cc.Op == "notIn") && len(cc.Values) == 0 {
+			return nil, fmt.Errorf("values is required for %s", cc.Op)
+		}
+		return c, nil
+	}
+
+	if cc.Op != "" || cc.Value != "" || len(cc.Values) > 0 {
+		return nil, fmt.Errorf("op, value and values are for field conditions")
+	}
+	if cc.Zone != "" {
+		if c.zone, err = time.LoadLocation(cc.Zone); err != nil {
+			return nil, err
+		}
+	}
+	if cc.Time != "" {
+		var parts = strings.Split(cc.Time, "-")
+		var from, to time.Time
+		if len(parts) == 2 {
+			from, err = time.Parse("15:04", parts[0])
+			if err == nil {
+				to, err = time.Parse("15:04", parts[1])
+			}
+		}
+		if len(parts) != 2 || err != nil {
+			return nil, fmt.Errorf("time must be a range such as \"09:00-17:30\", not %q", cc.Time)
+		}
+		c.from, c.to = sinceMidnight(from), sinceMidnight(to)
+	}
+	for _, d := range cc.Days {
+		if _, ok := weekdays[d]; !ok {
+			return nil, fmt.Errorf("unknown day %q, use Mon, Tue, Wed, Thu, Fri, Sat or Sun", d)
+		}
+	}
+	return c, nil
+}
+
+// sinceMidnight returns how long after midnight t's time of day is.
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+}
+
+// holds reports whether c holds for fields, a lookup's flattened request and response, at now.
+func (c *condition) holds(fields map[string]string, now time.Time) bool {
+	if c.Field != "" {
+		var v, ok = fields[c.Field]
+		return conditionOps[c.Op](c, v, ok)
+	}
+	now = now.In(c.zone)
+	if c.Time != "" {
+		var t = sinceMidnight(now)
+		var in = c.from <= t && t < c.to
+		if c.from > c.to {
+			in = t >= c.from || t < c.to
+		}
+		if !in {
+			return false
+		}
+	}
+	if len(c.Days) > 0 && !contains(c.Days, now.Weekday().String()[:3]) {
+		return false
+	}
+	return true
+}
+
+// String describes c, e.g. `Account.Name equals "x"` or `time 09:00-17:00 Mon,Tue in Asia/Kuala_Lumpur`.
+func (c *condition) String() string {
+	if c.Field != "" {
+		switch c.Op {
+		case "set", "notSet":
+			return c.Field + " " + c.Op
+		case "in", "notIn":
+			var b, _ = json.Marshal(c.Values)
+			return fmt.Sprintf("%s %s %s", c.Field, c.Op, b)
+		}
+		return fmt.Sprintf("%s %s %q", c.Field, c.Op, c.Value)
+	}
+	var parts = []string{"time"}
+	if c.Time != "" {
+		parts = append(parts, c.Time)
+	}
+	if len(c.Days) > 0 {
+		parts = append(parts, strings.Join(c.Days, ","))
+	}
+	return strings.Join(append(parts, "in", c.zone.String()), " ")
+}
+
+// ruleTrace is how a rule fared in an evaluation: whether it applied to the action, and the first condition that did
+// not hold, if any
+type ruleTrace struct {
+	rule    *rule
+	applies bool
+	failed  *condition
+}
+
+// evaluate runs the rules for a lookup by action, with its request and response, at now. It returns the attributes
+// set and how each rule fared.
+func (rs *ruleSet) evaluate(action string, req, resp interface{}, now time.Time) (map[string]string, []ruleTrace) {
+	var fields = lookupFields(req, resp)
+	var attrs = make(map[string]string)
+	var traces []ruleTrace
+	for i := range rs.rules {
+		var r = &rs.rules[i]
+		var t = ruleTrace{rule: r, applies: len(r.Actions) == 0 || contains(r.Actions, action)}
+		if t.applies {
+			for _, c := range r.conditions {
+				if !c.holds(fields, now) {
+					t.failed = c
+					break
+				}
+			}
+			if t.failed == nil {
+				for k, v := range r.Set {
+					if _, ok := attrs[k]; !ok {
+						attrs[k] = v
+					}
+				}
+			}
+		}
+		traces = append(traces, t)
+	}
+	return attrs, traces
+}
+
+// lookupFields returns the fields a condition can test: the response flattened as Architect sees it, and the request
+// fields under "Request.", all as text.
+func lookupFields(req, resp interface{}) map[string]string {
+	var fields = make(map[string]string)
+	if m, err := datadip.Flatten(resp); err == nil {
+		for k, v := range m.Values {
+			fields[k] = fmt.Sprint(v)
+		}
+	}
+	var b, _ = json.Marshal(req)
+	var r map[string]interface{}
+	json.Unmarshal(b, &r)
+	for k, v := range r {
+		fields["Request."+k] = fmt.Sprint(v)
+	}
+	return fields
+}
+
+// formatAttributes writes attrs as the CustomAttribute, e.g. "language=ms;queue=Gold;tier=VIP", sorted by name so
+// that flows can pick values out with Architect's string functions.
+func formatAttributes(attrs map[string]string) string {
+	var names = make([]string, 0, len(attrs))
+	for k := range attrs {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var parts = make([]string, len(names))
+	for i, k := range names {
+		parts[i] = k + "=" + attrs[k]
+	}
+	return strings.Join(parts, ";")
+}
+
+// contains reports whether list holds s.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
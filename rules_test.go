@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"purecloudwebservice/datadip"
+)
+
+func TestRules(t *testing.T) {
+	var rs, err = newRuleSet([]ruleConfig{
+		{Name: "vip", Actions: []string{datadip.ActionGetAccountByAccountNumber}, When: []conditionConfig{{Field: "Account.Name", Op: "matches", Value: "^Ng "}}, Set: map[string]string{"tier": "VIP", "queue": "Gold"}},
+		{Name: "malaysia", When: []conditionConfig{{Field: "Request.PhoneNumber", Op: "prefix", Value: "+60"}}, Set: map[string]string{"language": "ms"}},
+		{Name: "weekend nights", When: []conditionConfig{{Time: "22:00-06:00", Days: []string{"Sat", "Sun"}, Zone: "UTC"}}, Set: map[string]string{"queue": "Overflow"}},
+		{Name: "escalated", When: []conditionConfig{{Field: "Case.Status", Op: "in", Values: []string{"Escalated", "On Hold"}}}, Set: map[string]string{"queue": "Priority"}},
+		{Name: "no email", When: []conditionConfig{{Field: "Contact.EmailAddresses.EmailAddress[0].EmailAddress", Op: "notSet"}}, Set: map[string]string{"channel": "voice"}},
+		{Name: "default", Set: map[string]string{"queue": "General", "language": "en"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var saturday = time.Date(2026, 10, 17, 23, 0, 0, 0, time.UTC)
+	var monday = time.Date(2026, 10, 19, 23, 0, 0, 0, time.UTC)
+	var account = &datadip.AccountResponse{Account: datadip.Account{Name: "Ng Sze Min"}}
+	var contact = &datadip.ContactResponse{Contact: datadip.Contact{FullName: "Someone"}}
+	var caseRequest = &datadip.MostRecentOpenCaseByContactIDRequest{ContactID: "2"}
+	var tests = []struct {
+		name   string
+		action string
+		req    interface{}
+		resp   interface{}
+		now    time.Time
+		want   string
+	}{
+		{"vip account", datadip.ActionGetAccountByAccountNumber, &datadip.AccountByAccountNumberRequest{AccountNumber: "123"}, account, monday,
+			"channel=voice;language=en;queue=Gold;tier=VIP"},
+		{"malaysian caller on a weekend night", datadip.ActionGetContactByPhoneNumber, &datadip.ContactByPhoneNumberRequest{PhoneNumber: "+60327763333"}, contact, saturday,
+			"channel=voice;language=ms;queue=Overflow"},
+		{"other caller on a weekday", datadip.ActionGetContactByPhoneNumber, &datadip.ContactByPhoneNumberRequest{PhoneNumber: "+6512345678"}, contact, monday,
+			"channel=voice;language=en;queue=General"},
+		{"escalated case", datadip.ActionGetMostRecentOpenCaseByContactID, caseRequest, &datadip.CaseResponse{Case: datadip.Case{Status: "Escalated"}}, monday,
+			"channel=voice;language=en;queue=Priority"},
+		{"new case", datadip.ActionGetMostRecentOpenCaseByContactID, caseRequest, &datadip.CaseResponse{Case: datadip.Case{Status: "New"}}, monday,
+			"channel=voice;language=en;queue=General"},
+	}
+	for _, tt := range tests {
+		var attrs, _ = rs.evaluate(tt.action, tt.req, tt.resp, tt.now)
+		if got := formatAttributes(attrs); got != tt.want {
+			t.Errorf("%s: attributes = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	// The decorator sets the CustomAttribute of the response
+	var resp = &datadip.AccountResponse{Account: datadip.Account{Name: "Ng Sze Min", CustomAttribute: "from crm"}}
+	customAttributeDecorator(datadip.ActionGetAccountByAccountNumber, rs, nil)(&datadip.AccountByAccountNumberRequest{AccountNumber: "123"}, resp)
+	if !strings.Contains(resp.Account.CustomAttribute, "tier=VIP") {
+		t.Errorf("CustomAttribute = %q", resp.Account.CustomAttribute)
+	}
+}
+
+func TestRulesConfig(t *testing.T) {
+	var cfg = &config{Rules: []ruleConfig{
+		{Actions: []string{"GetAccountByContactId"}, When: []conditionConfig{
+			{Field: "Account.Name", Op: "like"},
+			{Field: "Account.Name", Op: "in"},
+			{Time: "9-5"},
+			{Days: []string{"Monday"}},
+			{Time: "09:00-17:00", Zone: "Nowhere/Special"},
+			{Field: "Account.Name", Op: "set", Time: "09:00-17:00"},
+		}, Set: map[string]string{"a=b": "c"}},
+	}}
+	cfg.applyDefaults()
+	var want = []string{
+		"rules[0].set: attribute names must not be empty or hold = or ;, and values must not hold ;",
+		`rules[0].actions: "GetAccountByContactId" is not an implemented action`,
+		`rules[0].when[0]: unknown op "like"`,
+		"rules[0].when[1]: values is required for in",
+		`rules[0].when[2]: time must be a range such as "09:00-17:30", not "9-5"`,
+		`rules[0].when[3]: unknown day "Monday", use Mon, Tue, Wed, Thu, Fri, Sat or Sun`,
+		"rules[0].when[4]: unknown time zone Nowhere/Special",
+		"rules[0].when[5]: a condition tests either a field or the time, not both",
+	}
+	if got := cfg.validate(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("problems =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
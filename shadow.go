@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"purecloudwebservice/datadip"
+)
+
+// shadowStats counts shadow comparisons by shadow store name: "<name>.compared", "<name>.differed", "<name>.failed"
+// and "<name>.skipped", and "<name>.fields.<Field>" for each response field found to differ
+var shadowStats = expvar.NewMap("shadow")
+
+// maxShadowInFlight is how many shadow lookups may run at once per shadow store. Lookups beyond that are not shadowed,
+// so that a slow shadow cannot pile up goroutines.
+const maxShadowInFlight = 64
+
+// shadowStore is a Store that answers every lookup from a primary backend while making the same lookup against a
+// shadow backend in the background, e.g. a new CRM about to replace the old one. The shadow's answer is never
+// returned; it is compared field by field with the primary's, and differences are counted and logged.
+//
+// Shadow lookups are given timeout, and run after the reply has been sent if they take longer than the primary. A
+// primary that fails is not compared.
+type shadowStore struct {
+	name     string
+	primary  datadip.CaseStore
+	shadow   datadip.CaseStore
+	timeout  time.Duration
+	inFlight chan struct{}
+}
+
+// newShadowStore returns a Store that answers from primary and compares shadow with it, counting under name.
+func newShadowStore(name string, primary, shadow datadip.CaseStore, timeout time.Duration) *shadowStore {
+	return &shadowStore{name: name, primary: primary, shadow: shadow, timeout: timeout, inFlight: make(chan struct{}, maxShadowInFlight)}
+}
+
+// GetAccountByAccountNumber looks up an account in the primary, and in the shadow to compare.
+func (s *shadowStore) GetAccountByAccountNumber(ctx context.Context, accountNumber string) (*datadip.Account, error) {
+	var account, err = s.primary.GetAccountByAccountNumber(ctx, accountNumber)
+	s.compare(datadip.ActionGetAccountByAccountNumber, accountNumber, account, err, func(ctx context.Context) (interface{}, error) {
+		return s.shadow.GetAccountByAccountNumber(ctx, accountNumber)
+	})
+	return account, err
+}
+
+// GetContactByPhoneNumber looks up a contact in the primary, and in the shadow to compare.
+func (s *shadowStore) GetContactByPhoneNumber(ctx context.Context, phoneNumber string) (*datadip.Contact, error) {
+	var contact, err = s.primary.GetContactByPhoneNumber(ctx, phoneNumber)
+	s.compare(datadip.ActionGetContactByPhoneNumber, phoneNumber, contact, err, func(ctx context.Context) (interface{}, error) {
+		return s.shadow.GetContactByPhoneNumber(ctx, phoneNumber)
+	})
+	return contact, err
+}
+
+// GetMostRecentOpenCaseByContactID looks up a case in the primary, and in the shadow to compare.
+func (s *shadowStore) GetMostRecentOpenCaseByContactID(ctx context.Context, contactID string) (*datadip.Case, error) {
+	var c, err = s.primary.GetMostRecentOpenCaseByContactID(ctx, contactID)
+	s.compare(datadip.ActionGetMostRecentOpenCaseByContactID, contactID, c, err, func(ctx context.Context) (interface{}, error) {
+		return s.shadow.GetMostRecentOpenCaseByContactID(ctx, contactID)
+	})
+	return c, err
+}
+
+// compare starts the shadow lookup and compares its answer with the primary's, record and err, for action and key.
+// It does not wait for the shadow.
+func (s *shadowStore) compare(action, key string, record interface{}, err error, lookup func(context.Context) (interface{}, error)) {
+	if err != nil && err != datadip.ErrNotFound {
+		return
+	}
+	// The primary's record is copied now, since the caller owns it once the lookup returns
+	var primary map[string]interface{}
+	if err == nil {
+		primary = recordFields(record)
+	}
+
+	select {
+	case s.inFlight <- struct{}{}:
+	default:
+		shadowStats.Add(s.name+".skipped", 1)
+		return
+	}
+	go func() {
+		defer func() { <-s.inFlight }()
+		var ctx, cancel = context.WithTimeout(context.Background(), s.timeout)
+		defer cancel()
+		var shadowRecord, err = lookup(ctx)
+		if err != nil && err != datadip.ErrNotFound {
+			shadowStats.Add(s.name+".failed", 1)
+			log.Printf("Shadow %s failed %s %s: %s\n", s.name, action, key, err)
+			return
+		}
+		var shadow map[string]interface{}
+		if err == nil {
+			shadow = recordFields(shadowRecord)
+		}
+
+		shadowStats.Add(s.name+".compared", 1)
+		var diffs = diffRecords(primary, shadow)
+		if len(diffs) == 0 {
+			return
+		}
+		shadowStats.Add(s.name+".differed", 1)
+		for _, d := range diffs {
+			shadowStats.Add(s.name+".fields."+d.field, 1)
+		}
+		log.Printf("Shadow %s differs for %s %s: %s\n", s.name, action, key, formatDiffs(diffs))
+	}()
+}
+
+// recordFields returns the fields of record as they appear in the JSON response, by name.
+func recordFields(record interface{}) map[string]interface{} {
+	var fields = make(map[string]interface{})
+	var b, _ = json.Marshal(record)
+	json.Unmarshal(b, &fields)
+	return fields
+}
+
+// fieldDiff is a response field that differs between the primary and the shadow, with each one's value in JSON
+type fieldDiff struct {
+	field   string
+	primary string
+	shadow  string
+}
+
+// diffRecords returns the fields that differ between primary and shadow, sorted by name. A nil record was not found;
+// a record found by only one of them is reported as the "record" pseudo field.
+func diffRecords(primary, shadow map[string]interface{}) []fieldDiff {
+	if primary == nil || shadow == nil {
+		if primary == nil && shadow == nil {
+			return nil
+		}
+		var found = func(m map[string]interface{}) string {
+			if m == nil {
+				return "not found"
+			}
+			return "found"
+		}
+		return []fieldDiff{{field: "record", primary: found(primary), shadow: found(shadow)}}
+	}
+
+	var names []string
+	for name := range primary {
+		names = append(names, name)
+	}
+	for name := range shadow {
+		if _, ok := primary[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var diffs []fieldDiff
+	for _, name := range names {
+		if reflect.DeepEqual(primary[name], shadow[name]) {
+			continue
+		}
+		var p, _ = json.Marshal(primary[name])
+		var sh, _ = json.Marshal(shadow[name])
+		diffs = append(diffs, fieldDiff{field: name, primary: string(p), shadow: string(sh)})
+	}
+	return diffs
+}
+
+// formatDiffs describes diffs on one line, e.g. `Name: "Ng Sze Min" != "Ng S M"`
+func formatDiffs(diffs []fieldDiff) string {
+	var parts = make([]string, len(diffs))
+	for i, d := range diffs {
+		parts[i] = fmt.Sprintf("%s: %s != %s", d.field, d.primary, d.shadow)
+	}
+	return strings.Join(parts, "; ")
+}
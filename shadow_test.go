@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"purecloudwebservice/datadip"
+	"purecloudwebservice/datadip/datadiptest"
+)
+
+func TestShadowStore(t *testing.T) {
+	var primary = datadiptest.NewStore()
+	var shadow = datadiptest.NewStore()
+	shadow.Accounts["123"] = &datadip.Account{ID: "1", Name: "Ng S M", Number: "123"}
+	shadow.Accounts["456"] = &datadip.Account{ID: "4", Number: "456"}
+	var s = newShadowStore("test-shadow", primary, shadow, time.Second)
+	var counters = []string{"compared", "differed", "fields.Name", "fields.EmailAddresses", "fields.record"}
+	var before = make(map[string]int64)
+	for _, name := range counters {
+		before[name] = expvarInt(shadowStats, "test-shadow."+name)
+	}
+
+	var lookups = []struct {
+		accountNumber string
+		err           error
+	}{
+		{"123", nil},
+		{"456", datadip.ErrNotFound},
+		{"999", datadip.ErrNotFound},
+	}
+	for _, l := range lookups {
+		// Lookups are answered by the primary
+		var account, err = s.GetAccountByAccountNumber(context.Background(), l.accountNumber)
+		if err != l.err || (err == nil && account.Name != "Ng Sze Min") {
+			t.Errorf("lookup of %s = %+v, %v", l.accountNumber, account, err)
+		}
+	}
+	if _, err := s.GetContactByPhoneNumber(context.Background(), "+60327763333"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Wait for the shadow lookups to finish by taking every in-flight slot
+	var deadline = time.After(5 * time.Second)
+	for i := 0; i < cap(s.inFlight); i++ {
+		select {
+		case s.inFlight <- struct{}{}:
+		case <-deadline:
+			t.Fatal("shadow lookups did not finish")
+		}
+	}
+	var want = map[string]int64{
+		"compared":              4,
+		"differed":              2,
+		"fields.Name":           1,
+		"fields.EmailAddresses": 1,
+		"fields.record":         1,
+	}
+	for _, name := range counters {
+		var n = want[name]
+		if got := expvarInt(shadowStats, "test-shadow."+name) - before[name]; got != n {
+			t.Errorf("%s = %d, want %d", name, got, n)
+		}
+	}
+}
+
+func TestDiffRecords(t *testing.T) {
+	var diffs = diffRecords(
+		recordFields(&datadip.Account{ID: "1", Name: "Ng Sze Min", Number: "123"}),
+		recordFields(&datadip.Account{ID: "1", Name: "Ng S M", Number: "123", CustomAttribute: "vip"}),
+	)
+	if got := formatDiffs(diffs); got != `CustomAttribute: null != "vip"; Name: "Ng Sze Min" != "Ng S M"` {
+		t.Errorf("diffs = %s", got)
+	}
+	if diffs = diffRecords(nil, nil); len(diffs) != 0 {
+		t.Errorf("diffs of two records not found = %+v", diffs)
+	}
+}
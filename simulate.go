@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"purecloudwebservice/datadip"
+)
+
+// simulate runs the simulate subcommand with args. It plays the part of the PureCloud Web Services Data Dip Connector:
+// it POSTs an action's request to a running service with datadip.Client, which sends it the way the connector does and
+// gives up after the connector's timeout, and prints the raw response followed by the flattened view Architect gets.
+func simulate(args []string) int {
+	var flags = flag.NewFlagSet("simulate", flag.ExitOnError)
+	var baseURL = flags.String("url", "http://localhost:8080", "base URL of the service, as configured on the connector")
+	var username = flags.String("user", "", "HTTP Basic username configured on the connector")
+	var password = flags.String("password", "", "HTTP Basic password configured on the connector")
+	var timeout = flags.Duration("timeout", datadip.DefaultTimeout, "how long the connector waits for a response")
+	var customAttribute = flags.String("custom", "", "CustomAttribute to send with the request")
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: purecloudwebservice simulate [-url url] [-user name -password secret] [-timeout d] [-custom value] action key")
+		return 2
+	}
+	var info, ok = datadip.FindAction(flags.Arg(0))
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown action %q\n", flags.Arg(0))
+		return 2
+	}
+
+	// Send the request the connector would send, giving up like the connector does
+	var body = map[string]string{info.KeyField: flags.Arg(1)}
+	if *customAttribute != "" {
+		body["CustomAttribute"] = *customAttribute
+	}
+	var b, _ = json.Marshal(body)
+	fmt.Printf("> POST %s/%s\n> %s\n\n", strings.TrimRight(*baseURL, "/"), info.Name, b)
+
+	var client = datadip.NewClient(*baseURL)
+	client.Username, client.Password, client.Timeout = *username, *password, *timeout
+	var start = time.Now()
+	var resp, respBody, err = client.Post(context.Background(), info.Name, body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Request failed after %s, the connector would take the failure path: %s\n", time.Since(start).Round(time.Millisecond), err)
+		return 1
+	}
+	var elapsed = time.Since(start).Round(time.Millisecond)
+
+	// Raw response
+	fmt.Printf("< %s %s (%s)\n", resp.Proto, resp.Status, elapsed)
+	var names = make([]string, 0, len(resp.Header))
+	for name := range resp.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("< %s: %s\n", name, strings.Join(resp.Header[name], ", "))
+	}
+	fmt.Printf("<\n%s\n", bytes.TrimRight(respBody, "\n"))
+	if resp.StatusCode != http.StatusOK {
+		fmt.Println("\nThe connector would take the failure path")
+		return 1
+	}
+
+	// Flattened view
+	var m *datadip.Metadata
+	if m, err = datadip.FlattenJSON(info.Response, respBody); err != nil {
+		fmt.Printf("\nResponse is not JSON, the connector would take the failure path: %s\n", err)
+		return 1
+	}
+	fmt.Println("\nFlattened metadata:")
+	for _, k := range m.Keys() {
+		var vb, _ = json.Marshal(m.Values[k])
+		fmt.Printf("  %s = %s\n", k, vb)
+	}
+	for _, k := range m.NotSet {
+		fmt.Printf("  %s = %s\n", k, datadip.NotSet)
+	}
+	return 0
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"purecloudwebservice/datadip"
+	"purecloudwebservice/datadip/datadiptest"
+)
+
+func TestSimulate(t *testing.T) {
+	var store = datadiptest.NewStore()
+	var handler = datadip.NewHandler(store)
+	var sent *http.Request
+	var sentBody string
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var b, _ = ioutil.ReadAll(r.Body)
+		sent, sentBody = r, string(b)
+		r.Body = ioutil.NopCloser(strings.NewReader(sentBody))
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	// The request is shaped like the connector's, and the response is printed raw and then flattened
+	var code int
+	var out = captureStdout(t, func() {
+		code = simulate([]string{"-url", server.URL + "/", "-user", "purecloud", "-password", "secret", "-custom", "x", datadip.ActionGetAccountByAccountNumber, "123"})
+	})
+	if code != 0 {
+		t.Fatalf("exit code = %d, output:\n%s", code, out)
+	}
+	if username, password, _ := sent.BasicAuth(); sent.Method != "POST" || sent.URL.Path != "/GetAccountByAccountNumber" || username != "purecloud" || password != "secret" ||
+		sent.Header.Get("Content-Type") != "application/json" || sent.Header.Get("Accept") != "application/json" {
+		t.Errorf("request = %s %s, header %v", sent.Method, sent.URL, sent.Header)
+	}
+	if sentBody != `{"AccountNumber":"123","CustomAttribute":"x"}` {
+		t.Errorf("request body = %s", sentBody)
+	}
+	for _, want := range []string{
+		"< HTTP/1.1 200 OK",
+		"< Content-Type: application/json",
+		`{"Account":{"Id":"1","Name":"Ng Sze Min"`,
+		"Flattened metadata:",
+		`  Account.Name = "Ng Sze Min"`,
+		`  Account.EmailAddresses.EmailAddress[0].EmailAddress = "szemin.ng@inin.com"`,
+		"  Account.CustomAttribute = " + datadip.NotSet,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not hold %q:\n%s", want, out)
+		}
+	}
+
+	// A reply other than 200 OK, or none within the timeout, takes the failure path
+	out = captureStdout(t, func() {
+		code = simulate([]string{"-url", server.URL, datadip.ActionGetAccountByAccountNumber, "999"})
+	})
+	if code != 1 || !strings.Contains(out, "404 Not Found") || !strings.Contains(out, "The connector would take the failure path") {
+		t.Errorf("not found: exit code = %d, output:\n%s", code, out)
+	}
+	store.Delay = time.Second
+	var start = time.Now()
+	captureStdout(t, func() {
+		code = simulate([]string{"-url", server.URL, "-timeout", "50ms", datadip.ActionGetAccountByAccountNumber, "123"})
+	})
+	if code != 1 || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("timeout: exit code = %d after %s", code, time.Since(start))
+	}
+
+	if code = simulate([]string{datadip.ActionGetAccountByAccountNumber}); code != 2 {
+		t.Errorf("missing key: exit code = %d, want 2", code)
+	}
+}
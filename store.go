@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+
+	"purecloudwebservice/datadip"
+)
+
+// sampleStore is a Store that returns the same hardcoded account, contact and case for every lookup. It is just an example.
+type sampleStore struct{}
+
+// GetAccountByAccountNumber returns the sample account regardless of the account number asked for.
+func (sampleStore) GetAccountByAccountNumber(ctx context.Context, accountNumber string) (*datadip.Account, error) {
+	/* Just an example, hardcode response here.  Sending the following response
+		{
+		    "Account": {
+	    	    "Id": "123",
+	        	"Name": "Ng Sze Min",
+		        "Number": "123",
+	    	    "EmailAddresses": {
+	        	    "EmailAddress": [
+	            	    {
+	                	    "EmailAddress": "szemin.ng@inin.com",
+	                    	"EmailType": 1
+		                }
+	    	        ]
+	        	},
+		        "PhoneNumbers": {
+	    	        "PhoneNumber": [
+	        	        {
+	            	        "Number": "+60327763333",
+	                	    "PhoneType": 1
+		                },
+	    	            {
+	        	            "Number": "+18002671364",
+	            	        "PhoneType": 2
+	                	}
+		            ]
+	    	    },
+	        	"Addresses": {
+	            	"Address": [
+	                	{
+	                    	"City": "Kuala Lumpur",
+		                    "Country": "Malaysia",
+	    	                "Line1": "Unit 9.1, Level 9, Menara Prestige",
+	        	            "Line2": "No. 1, Jalan Pinang",
+	            	        "PostalCode": "50450",
+	                	    "State": "FT",
+	                    	"Type": "MY"
+		                },
+	    	            {
+	        	            "City": "Indianapolis",
+	            	        "Country": "United States",
+	                	    "Line1": "7601 Interactive Way",
+	                    	"PostalCode": "46278",
+		                    "State": "IN",
+	    	                "Type": "US"
+	        	        }
+	            	]
+		        },
+	    	    "CustomAttribute": "Custom data here"
+		    }
+		}*/
+	return &datadip.Account{
+		ID:     "123",
+		Name:   "Ng Sze Min",
+		Number: "123",
+		Addresses: &datadip.Addresses{
+			Address: []datadip.Address{
+				datadip.Address{City: "Kuala Lumpur", Country: "Malaysia", Line1: "Unit 9.1, Level 9, Menara Prestige", Line2: "No. 1, Jalan Pinang", PostalCode: "50450", State: "FT", Type: "MY"},
+				datadip.Address{City: "Indianapolis", Country: "United States", Line1: "7601 Interactive Way", PostalCode: "46278", State: "IN", Type: "US"},
+			},
+		},
+		PhoneNumbers: &datadip.PhoneNumbers{
+			PhoneNumbers: []datadip.PhoneNumber{
+				datadip.PhoneNumber{Number: "+60327763333", PhoneType: 1},
+				datadip.PhoneNumber{Number: "+18002671364", PhoneType: 2},
+			},
+		},
+		EmailAddresses: &datadip.EmailAddresses{
+			EmailAddress: []datadip.EmailAddress{
+				datadip.EmailAddress{EmailAddress: "szemin.ng@inin.com", EmailType: 1},
+			},
+		},
+		CustomAttribute: "Custom data here",
+	}, nil
+}
+
+// GetContactByPhoneNumber returns the sample contact regardless of the phone number asked for.
+func (sampleStore) GetContactByPhoneNumber(ctx context.Context, phoneNumber string) (*datadip.Contact, error) {
+	/* Just an example, hardcode response here.  Sending the following response
+	{
+	  "Contact": {
+	    "EmailAddresses": {
+	      "EmailAddress": [
+	        {
+	          "EmailAddress": "szemin.ng@inin.com",
+	          "EmailType": 1
+	        }
+	      ]
+	    },
+	    "FirstName": "Sze Min",
+	    "LastName": "Ng",
+	    "FullName": "Ng Sze Min",
+	    "Id": "1234567890",
+	    "PhoneNumbers": {
+	      "PhoneNumber": [
+	        {
+	          "Number": "+60327763333",
+	          "PhoneType": 1
+	        },
+	        {
+	          "Number": "+60327763324",
+	          "PhoneType": 2
+	        }
+	      ]
+	    },
+	    "Address": {
+	      "City": "Kuala Lumpur",
+	      "Country": "Malaysia",
+	      "Line1": "Unit 9.1, Level 9, Menara Prestige",
+	      "Line2": "No. 1, Jalan Pinang",
+	      "PostalCode": "50450",
+	      "State": "FT"
+	    }
+	  }
+	}*/
+	return &datadip.Contact{
+		EmailAddresses: &datadip.EmailAddresses{
+			EmailAddress: []datadip.EmailAddress{
+				datadip.EmailAddress{EmailAddress: "szemin.ng@inin.com", EmailType: 1},
+			},
+		},
+		FirstName: "Sze Min",
+		LastName:  "Ng",
+		FullName:  "Ng Sze Min",
+		ID:        "1234567890",
+		PhoneNumbers: &datadip.PhoneNumbers{
+			PhoneNumbers: []datadip.PhoneNumber{
+				datadip.PhoneNumber{Number: "+60327763333", PhoneType: 1},
+				datadip.PhoneNumber{Number: "+60327763324", PhoneType: 2},
+			},
+		},
+		Address: &datadip.Address{
+			City:       "Kuala Lumpur",
+			Country:    "Malaysia",
+			Line1:      "Unit 9.1, Level 9, Menara Prestige",
+			Line2:      "No. 1, Jalan Pinang",
+			PostalCode: "50450",
+			State:      "FT",
+		},
+	}, nil
+}
+
+// GetMostRecentOpenCaseByContactID returns the sample case regardless of the contact id asked for.
+func (sampleStore) GetMostRecentOpenCaseByContactID(ctx context.Context, contactID string) (*datadip.Case, error) {
+	/* Just an example, hardcode response here.  Sending the following response
+	{
+	  "Case": {
+	    "Id": "5000000001",
+	    "Number": "00001026",
+	    "Subject": "Billing enquiry",
+	    "Description": "Customer asked why their last bill was higher than usual",
+	    "Status": "New",
+	    "Priority": "Medium",
+	    "CreatedDate": "2017-03-01T09:00:00Z",
+	    "ContactId": "1234567890"
+	  }
+	}*/
+	return &datadip.Case{
+		ID:          "5000000001",
+		Number:      "00001026",
+		Subject:     "Billing enquiry",
+		Description: "Customer asked why their last bill was higher than usual",
+		Status:      "New",
+		Priority:    "Medium",
+		CreatedDate: "2017-03-01T09:00:00Z",
+		ContactID:   "1234567890",
+	}, nil
+}
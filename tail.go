@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"purecloudwebservice/datadip"
+)
+
+// tailKeepAlive is how often an idle live tail sends a comment, so that proxies do not close the connection
+const tailKeepAlive = 15 * time.Second
+
+// tailEvent is one lookup as the live tail shows it. Key is redacted.
+type tailEvent struct {
+	Time    time.Time `json:"time"`
+	Action  string    `json:"action"`
+	Key     string    `json:"key"`
+	Result  string    `json:"result"`
+	Status  int       `json:"status"`
+	Latency duration  `json:"latency"`
+}
+
+// newTailEvent returns the live tail event for r.
+func newTailEvent(r lookupRecord) tailEvent {
+	return tailEvent{Time: r.Time, Action: r.Action, Key: redactKey(r.key()), Result: r.result(), Status: r.Status, Latency: r.Latency}
+}
+
+// redactKey masks all but the last four characters of key, e.g. "+60327763333" becomes "********3333". Keys of four
+// characters or fewer are masked completely.
+func redactKey(key string) string {
+	var runes = []rune(key)
+	var shown = 4
+	if len(runes) <= shown {
+		shown = 0
+	}
+	return strings.Repeat("*", len(runes)-shown) + string(runes[len(runes)-shown:])
+}
+
+// tail handles HTTP GETs to /debug/tail. It streams each lookup made by the connector as a Server-Sent Event named
+// "lookup" as soon as the lookup completes, until the client goes away. The action and key query parameters, if
+// given, only let through lookups for that action or that key. Keys are matched in full but sent redacted.
+func tail(w http.ResponseWriter, r *http.Request) {
+	var flusher, ok = w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintln(w, "streaming is not supported")
+		return
+	}
+	var action, key = r.URL.Query().Get("action"), r.URL.Query().Get("key")
+	if _, known := datadip.FindAction(action); action != "" && !known {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "unknown action %q\n", action)
+		return
+	}
+
+	log.Printf("Live tail started for %s\n", r.RemoteAddr)
+	defer log.Printf("Live tail ended for %s\n", r.RemoteAddr)
+	var lookups, unsubscribe = recentLookups.subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": tailing lookups\n\n")
+	flusher.Flush()
+
+	var keepAlive = time.NewTicker(tailKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case rec := <-lookups:
+			if action != "" && rec.Action != action {
+				continue
+			}
+			if key != "" && !sameKey(rec.Action, rec.key(), key) {
+				continue
+			}
+			var b, _ = json.Marshal(newTailEvent(rec))
+			fmt.Fprintf(w, "event: lookup\ndata: %s\n\n", b)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// sameKey reports whether a and b are the same lookup key of action. Phone numbers match ignoring formatting such as
+// spaces and dashes; other keys must match exactly.
+func sameKey(action, a, b string) bool {
+	if a == b {
+		return true
+	}
+	var info, ok = datadip.FindAction(action)
+	return ok && info.KeyField == "PhoneNumber" && normalizePhoneNumber(a) != "" && normalizePhoneNumber(a) == normalizePhoneNumber(b)
+}
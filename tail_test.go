@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"purecloudwebservice/datadip"
+	"purecloudwebservice/datadip/datadiptest"
+)
+
+func TestTail(t *testing.T) {
+	var server = httptest.NewServer(newTestRouter(new(config), datadiptest.NewStore(), time.Second))
+	defer server.Close()
+
+	var resp, err = http.Get(server.URL + "/debug/tail?action=GetContactByPhoneNumber&key=%2B60%203-2776%203333")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusOK || ct != "text/event-stream" {
+		t.Fatalf("status = %d, Content-Type = %q", resp.StatusCode, ct)
+	}
+
+	// Only the lookup of the contact asked for comes through
+	var lookups = []struct{ action, body string }{
+		{datadip.ActionGetAccountByAccountNumber, `{"AccountNumber":"123"}`},
+		{datadip.ActionGetContactByPhoneNumber, `{"PhoneNumber":"+1"}`},
+		{datadip.ActionGetContactByPhoneNumber, `{"PhoneNumber":"+60327763333"}`},
+	}
+	for _, l := range lookups {
+		var r, err = http.Post(server.URL+"/"+l.action, "application/json", strings.NewReader(l.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Body.Close()
+	}
+
+	var scanner = bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if !strings.HasPrefix(scanner.Text(), "data: ") {
+			continue
+		}
+		var event tailEvent
+		if err = json.Unmarshal([]byte(strings.TrimPrefix(scanner.Text(), "data: ")), &event); err != nil {
+			t.Fatal(err)
+		}
+		if event.Action != datadip.ActionGetContactByPhoneNumber || event.Key != "********3333" || event.Result != "found" || event.Status != http.StatusOK {
+			t.Errorf("event = %+v", event)
+		}
+		return
+	}
+	t.Fatalf("no event: %v", scanner.Err())
+}
+
+func TestTailKey(t *testing.T) {
+	var store = datadiptest.NewStore()
+	store.Accounts = map[string]*datadip.Account{"ACC-001": {ID: "1", Number: "ACC-001"}}
+	var server = httptest.NewServer(newTestRouter(new(config), store, time.Second))
+	defer server.Close()
+
+	var resp, err = http.Get(server.URL + "/debug/tail?key=ACC-001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// Account numbers with the same digits are different keys, so the other customer's lookup does not come through
+	for _, number := range []string{"XYZ-001", "ACC-001"} {
+		var r, err = http.Post(server.URL+"/"+datadip.ActionGetAccountByAccountNumber, "application/json", strings.NewReader(`{"AccountNumber":"`+number+`"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Body.Close()
+	}
+
+	var scanner = bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if !strings.HasPrefix(scanner.Text(), "data: ") {
+			continue
+		}
+		var event tailEvent
+		if err = json.Unmarshal([]byte(strings.TrimPrefix(scanner.Text(), "data: ")), &event); err != nil {
+			t.Fatal(err)
+		}
+		if event.Result != "found" {
+			t.Errorf("event = %+v, want the lookup of ACC-001", event)
+		}
+		return
+	}
+	t.Fatalf("no event: %v", scanner.Err())
+}
+
+func TestSameKey(t *testing.T) {
+	var tests = []struct {
+		action string
+		a, b   string
+		want   bool
+	}{
+		{datadip.ActionGetContactByPhoneNumber, "+60327763333", "+60 3-2776 3333", true},
+		{datadip.ActionGetContactByPhoneNumber, "+60327763333", "+60327763334", false},
+		{datadip.ActionGetAccountByAccountNumber, "ACC-001", "ACC-001", true},
+		{datadip.ActionGetAccountByAccountNumber, "ACC-001", "XYZ-001", false},
+		{datadip.ActionGetMostRecentOpenCaseByContactID, "C100", "D100", false},
+	}
+	for _, tt := range tests {
+		if got := sameKey(tt.action, tt.a, tt.b); got != tt.want {
+			t.Errorf("sameKey(%s, %q, %q) = %v, want %v", tt.action, tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestLookupResult(t *testing.T) {
+	var tests = []struct {
+		status   int
+		response string
+		want     string
+	}{
+		{http.StatusOK, `{"Account":{"Id":"1"}}`, "found"},
+		{http.StatusOK, `{"Contact":{}}`, "fallback"},
+		{http.StatusNotFound, "record not found\n", "not found"},
+		{http.StatusBadRequest, "unexpected EOF\n", "bad request"},
+		{http.StatusInternalServerError, "context deadline exceeded\n", "error"},
+		{http.StatusNotImplemented, "501\n", "not implemented"},
+	}
+	for _, tt := range tests {
+		if got := (lookupRecord{Status: tt.status, Response: tt.response}).result(); got != tt.want {
+			t.Errorf("result of %d %s = %q, want %q", tt.status, tt.response, got, tt.want)
+		}
+	}
+	if got := redactKey("+60327763333"); got != "********3333" {
+		t.Errorf("redactKey = %q", got)
+	}
+	if got := redactKey("123"); got != "***" {
+		t.Errorf("redactKey of a short key = %q", got)
+	}
+}